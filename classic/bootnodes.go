@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// reachableBootnodes returns the enodes of the list accepting a TCP connection
+// within timeout, in their original order. All nodes are dialed concurrently,
+// so the check never takes much longer than timeout. Enodes that cannot be
+// parsed are considered unreachable.
+func reachableBootnodes(enodes []string, timeout time.Duration) []string {
+	reachable := make([]bool, len(enodes))
+
+	var wg sync.WaitGroup
+	for i, enode := range enodes {
+		u, err := url.Parse(enode)
+		if err != nil || u.Scheme != "enode" || u.Host == "" {
+			log.Warn("Skipping malformed bootnode", "enode", enode)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			conn, err := net.DialTimeout("tcp", addr, timeout)
+			if err != nil {
+				return
+			}
+			conn.Close()
+			reachable[i] = true
+		}(i, u.Host)
+	}
+	wg.Wait()
+
+	var result []string
+	for i, enode := range enodes {
+		if reachable[i] {
+			result = append(result, enode)
+		}
+	}
+	return result
+}
+
+// checkBootnodes prunes unreachable nodes from ClassicBootnodes. If none can
+// be reached, for example because the host is offline, the list is kept as is.
+func checkBootnodes(timeout time.Duration) {
+	reachable := reachableBootnodes(ClassicBootnodes, timeout)
+	log.Info("Checked bootnode reachability", "reachable", len(reachable), "total", len(ClassicBootnodes))
+	if len(reachable) == 0 {
+		log.Warn("No bootnode reachable, keeping the full list")
+		return
+	}
+	ClassicBootnodes = reachable
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReachableBootnodes(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// A port nothing listens on anymore
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	var (
+		up        = "enode://aa@" + listener.Addr().String()
+		down      = "enode://bb@" + closed.Addr().String()
+		malformed = "http://cc@" + listener.Addr().String()
+	)
+	enodes := []string{down, up, malformed, up + "?discport=30301"}
+
+	start := time.Now()
+	reachable := reachableBootnodes(enodes, time.Second)
+	if want := []string{up, up + "?discport=30301"}; !reflect.DeepEqual(reachable, want) {
+		t.Errorf("reachable bootnodes %v, want %v", reachable, want)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("check took %v with a timeout of 1s", elapsed)
+	}
+
+	defer func(bootnodes []string) { ClassicBootnodes = bootnodes }(ClassicBootnodes)
+	ClassicBootnodes = enodes
+	checkBootnodes(time.Second)
+	if want := []string{up, up + "?discport=30301"}; !reflect.DeepEqual(ClassicBootnodes, want) {
+		t.Errorf("pruned bootnodes %v, want %v", ClassicBootnodes, want)
+	}
+	// Without any reachable node the list is kept
+	ClassicBootnodes = []string{down}
+	checkBootnodes(time.Second)
+	if want := []string{down}; !reflect.DeepEqual(ClassicBootnodes, want) {
+		t.Errorf("bootnodes %v after a failed check, want %v", ClassicBootnodes, want)
+	}
+}
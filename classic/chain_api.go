@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/crypto"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+)
+
+// DAOForkResult describes the DAO fork parameters and Classic's stance on it.
+type DAOForkResult struct {
+	Block          uint64        `json:"block"`
+	ExtraData      hexutil.Bytes `json:"extraData"`
+	ExtraDataRange uint64        `json:"extraDataRange"`
+	RefundContract core.Address  `json:"refundContract"`
+	Supported      bool          `json:"supported"`
+	Note           string        `json:"note"`
+}
+
+// DAOForkInfo returns the parameters of the DAO hard fork, which Ethereum
+// Classic rejected.
+func (service *ClassicService) DAOForkInfo(ctx context.Context) (*DAOForkResult, error) {
+	return &DAOForkResult{
+		Block:          DAOForkBlock.Uint64(),
+		ExtraData:      hexutil.Bytes(DAOForkBlockExtra),
+		ExtraDataRange: DAOForkExtraRange.Uint64(),
+		RefundContract: DAORefundContract,
+		Supported:      false,
+		Note:           "Ethereum Classic rejected the DAO fork and continued the original chain",
+	}, nil
+}
+
+// chainParametersVersion is bumped whenever the shape of ChainParametersResult
+// changes in a way integrators need to know about.
+const chainParametersVersion = 1
+
+// ChainParametersResult describes the chain in a single response so that
+// wallets and SDKs can bootstrap from one call.
+type ChainParametersResult struct {
+	Version     int       `json:"version"`
+	ChainID     uint64    `json:"chainId"`
+	NetworkID   uint64    `json:"networkId"`
+	GenesisHash core.Hash `json:"genesisHash"`
+	ForkBlocks  []uint64  `json:"forkBlocks"`
+	ForkTimes   []uint64  `json:"forkTimes"`
+	Consensus   string    `json:"consensus"`
+	FeeModel    string    `json:"feeModel"`
+	EraLength   uint64    `json:"eraLength"`
+}
+
+// ChainParameters returns the canonical parameters of Ethereum Classic.
+func (service *ClassicService) ChainParameters(ctx context.Context) (*ChainParametersResult, error) {
+	blocks, times := ForkIDs(nil, nil)
+	return &ChainParametersResult{
+		Version:     chainParametersVersion,
+		ChainID:     etc_config.ChainID.Uint64(),
+		NetworkID:   *SetNetworkId(),
+		GenesisHash: classicGenesisHash,
+		ForkBlocks:  append([]uint64{}, blocks...),
+		ForkTimes:   append([]uint64{}, times...),
+		Consensus:   "ethash",
+		FeeModel:    "legacy",
+		EraLength:   etc_config.ECIP1017EraRounds.Uint64(),
+	}, nil
+}
+
+// FullDescriptor bundles the chain, fork, reward and ethash facts exposed by
+// the plugin into a single document.
+type FullDescriptor struct {
+	Chain          *ChainParametersResult `json:"chain"`
+	Forks          *ForkStatusResult      `json:"forks"`
+	MonetaryPolicy *MonetaryPolicyResult  `json:"monetaryPolicy"`
+	Ethash         *EthashParamsResult    `json:"ethash"`
+	Consensus      string                 `json:"consensus"`
+	FeeModel       string                 `json:"feeModel"`
+}
+
+// ChainDescriptor returns the machine readable description of the running
+// Ethereum Classic node, composed from the outputs of ChainParameters,
+// ForkStatus, MonetaryPolicy and EthashParams.
+func (service *ClassicService) ChainDescriptor(ctx context.Context) (*FullDescriptor, error) {
+	chain, err := service.ChainParameters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	forks, err := service.ForkStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := service.MonetaryPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ethash, err := service.EthashParams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &FullDescriptor{
+		Chain:          chain,
+		Forks:          forks,
+		MonetaryPolicy: policy,
+		Ethash:         ethash,
+		Consensus:      chain.Consensus,
+		FeeModel:       chain.FeeModel,
+	}, nil
+}
+
+// ConsensusEngine returns the name of the consensus engine governing the given
+// block.
+func (service *ClassicService) ConsensusEngine(ctx context.Context, blockNr restricted.BlockNumber) (string, error) {
+	var number *big.Int
+	if blockNr < 0 {
+		head, err := service.headHeader()
+		if err != nil {
+			return "", err
+		}
+		number = head.Number
+	} else {
+		number = big.NewInt(int64(blockNr))
+	}
+	return ConsensusEngine(number).String(), nil
+}
+
+var errNodeNotInitialized = errors.New("node not initialized")
+
+// ChainConfig returns the chain config stored for the host under the
+// ethereum-config-<genesis hash> key, as written by InitializeNode.
+func (service *ClassicService) ChainConfig(ctx context.Context) (json.RawMessage, error) {
+	b := backend
+	if b == nil {
+		return nil, errNodeNotInitialized
+	}
+	key := append([]byte("ethereum-config-"), configGenesisHash(b).Bytes()...)
+	data, err := b.ChainDb().Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("stored chain config is not valid JSON")
+	}
+	return json.RawMessage(data), nil
+}
+
+// forkConfigHash returns the keccak256 hash over the chain id, the genesis
+// hash and the sorted fork blocks and times.
+func forkConfigHash(chainID uint64, genesis core.Hash, blocks, times []uint64) []byte {
+	sorted := func(list []uint64) []uint64 {
+		list = append([]uint64{}, list...)
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		return list
+	}
+	var buf []byte
+	buf = binary.BigEndian.AppendUint64(buf, chainID)
+	buf = append(buf, genesis[:]...)
+	for _, list := range [][]uint64{sorted(blocks), sorted(times)} {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(len(list)))
+		for _, fork := range list {
+			buf = binary.BigEndian.AppendUint64(buf, fork)
+		}
+	}
+	return crypto.Keccak256(buf)
+}
+
+// ForkConfigHash returns a deterministic hash of the fork configuration, so
+// that nodes can be checked for an identical configuration by comparing a
+// single value.
+func (service *ClassicService) ForkConfigHash(ctx context.Context) (hexutil.Bytes, error) {
+	blocks, times := ForkIDs(nil, nil)
+	return forkConfigHash(etc_config.ChainID.Uint64(), classicGenesisHash, blocks, times), nil
+}
+
+// RelativeToDAOSplit reports whether the given block is part of the history
+// Ethereum Classic shares with Ethereum ("pre-split") or was produced after
+// the chains diverged at the DAO fork block ("post-split").
+func (service *ClassicService) RelativeToDAOSplit(ctx context.Context, blockNr restricted.BlockNumber) (string, error) {
+	var number uint64
+	if blockNr < 0 {
+		head, err := service.headHeader()
+		if err != nil {
+			return "", err
+		}
+		number = head.Number.Uint64()
+	} else {
+		number = uint64(blockNr)
+	}
+	if number < DAOForkBlock.Uint64() {
+		return "pre-split", nil
+	}
+	return "post-split", nil
+}
+
+// ReplayProtectionResult reports whether EIP-155 replay protection is active
+// and the chain id transactions must be signed with.
+type ReplayProtectionResult struct {
+	Active  bool         `json:"active"`
+	ChainID *hexutil.Big `json:"chainId,omitempty"`
+}
+
+// ReplayProtectionActive reports whether EIP-155 replay protection is in
+// effect at the current head.
+func (service *ClassicService) ReplayProtectionActive(ctx context.Context) (*ReplayProtectionResult, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return nil, err
+	}
+	if !Is160(head.Number) {
+		return &ReplayProtectionResult{}, nil
+	}
+	return &ReplayProtectionResult{Active: true, ChainID: (*hexutil.Big)(new(big.Int).Set(etc_config.ChainID))}, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+)
+
+func TestDAOForkInfo(t *testing.T) {
+	info, err := new(ClassicService).DAOForkInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Block != 1_920_000 || info.ExtraDataRange != 10 || info.Supported {
+		t.Errorf("block %d, extra data range %d, supported %v, want 1920000, 10, false", info.Block, info.ExtraDataRange, info.Supported)
+	}
+	if !bytes.Equal(info.ExtraData, []byte("dao-hard-fork")) {
+		t.Errorf("extra data %q, want %q", info.ExtraData, "dao-hard-fork")
+	}
+	if want := core.HexToAddress("0xbf4ed7b27f1d666546e30d74d50d173d20bca754"); info.RefundContract != want {
+		t.Errorf("refund contract %x, want %x", info.RefundContract, want)
+	}
+}
+
+func TestChainParameters(t *testing.T) {
+	params, err := new(ClassicService).ChainParameters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.ChainID != 61 || params.NetworkID != 1 || params.EraLength != 5_000_000 {
+		t.Errorf("chain id %d, network id %d, era length %d, want 61, 1, 5000000", params.ChainID, params.NetworkID, params.EraLength)
+	}
+	if params.GenesisHash != core.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3") {
+		t.Errorf("genesis hash %x", params.GenesisHash)
+	}
+	if len(params.ForkBlocks) == 0 || params.ForkBlocks[len(params.ForkBlocks)-1] != 19_250_000 {
+		t.Errorf("fork blocks %v, want the schedule up to Spiral", params.ForkBlocks)
+	}
+	if params.Version != chainParametersVersion || params.Consensus != "ethash" || params.FeeModel != "legacy" {
+		t.Errorf("version %d, consensus %q, fee model %q", params.Version, params.Consensus, params.FeeModel)
+	}
+}
+
+func TestForkConfigHash(t *testing.T) {
+	first, err := new(ClassicService).ForkConfigHash(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := new(ClassicService).ForkConfigHash(context.Background())
+	if !bytes.Equal(first, second) {
+		t.Fatalf("hash changed between calls: %x != %x", first, second)
+	}
+	blocks, times := ForkIDs(nil, nil)
+	if hash := forkConfigHash(61, classicGenesisHash, blocks, times); !bytes.Equal(hash, first) {
+		t.Errorf("hash %x, want %x", hash, first)
+	}
+	// The order the forks are listed in does not matter, their blocks do.
+	reversed := make([]uint64, len(blocks))
+	for i, block := range blocks {
+		reversed[len(blocks)-1-i] = block
+	}
+	if hash := forkConfigHash(61, classicGenesisHash, reversed, times); !bytes.Equal(hash, first) {
+		t.Errorf("reordered forks hash to %x, want %x", hash, first)
+	}
+	moved := append([]uint64{}, blocks...)
+	moved[len(moved)-1]++
+	if hash := forkConfigHash(61, classicGenesisHash, moved, times); bytes.Equal(hash, first) {
+		t.Error("moving a fork block kept the hash")
+	}
+	if hash := forkConfigHash(63, classicGenesisHash, blocks, times); bytes.Equal(hash, first) {
+		t.Error("changing the chain id kept the hash")
+	}
+}
+
+func TestRelativeToDAOSplit(t *testing.T) {
+	service := testService(20_000_000)
+	tests := []struct {
+		block restricted.BlockNumber
+		want  string
+	}{
+		{0, "pre-split"},
+		{1_919_999, "pre-split"},
+		{1_920_000, "post-split"},
+		{restricted.LatestBlockNumber, "post-split"},
+	}
+	for _, tt := range tests {
+		label, err := service.RelativeToDAOSplit(context.Background(), tt.block)
+		if err != nil {
+			t.Fatalf("block %d: %v", tt.block, err)
+		}
+		if label != tt.want {
+			t.Errorf("block %d: %q, want %q", tt.block, label, tt.want)
+		}
+	}
+}
+
+func TestReplayProtectionActive(t *testing.T) {
+	result, err := testService(3_000_000).ReplayProtectionActive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Active || result.ChainID == nil || result.ChainID.ToInt().Int64() != 61 {
+		t.Errorf("at block 3000000: %+v, want active with chain id 61", result)
+	}
+	if result, _ := testService(2_999_999).ReplayProtectionActive(context.Background()); result.Active || result.ChainID != nil {
+		t.Errorf("at block 2999999: %+v, want inactive", result)
+	}
+}
+
+func TestChainDescriptor(t *testing.T) {
+	descriptor, err := testService(20_000_000).ChainDescriptor(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if descriptor.Chain == nil || descriptor.Forks == nil || descriptor.MonetaryPolicy == nil || descriptor.Ethash == nil {
+		t.Fatalf("descriptor missing sections: %+v", descriptor)
+	}
+	if descriptor.Chain.ChainID != 61 || descriptor.Chain.NetworkID != 1 {
+		t.Errorf("chain id %d, network id %d, want 61 and 1", descriptor.Chain.ChainID, descriptor.Chain.NetworkID)
+	}
+	if descriptor.Forks.Head != 20_000_000 {
+		t.Errorf("forks evaluated at %d, want the head 20000000", descriptor.Forks.Head)
+	}
+	for _, fork := range descriptor.Forks.Forks {
+		if !fork.Active {
+			t.Errorf("fork %s inactive past Spiral", fork.Name)
+		}
+	}
+	if policy := descriptor.MonetaryPolicy; policy.EraLength != 5_000_000 || policy.CurrentEra != 3 || policy.CurrentEraReward.ToInt().Cmp(etc(2.56)) != 0 {
+		t.Errorf("monetary policy era length %d, era %d paying %v, want 5000000, 3 and 2.56 ETC", policy.EraLength, policy.CurrentEra, policy.CurrentEraReward)
+	}
+	if descriptor.Ethash.MixBytes != mixBytes || descriptor.Ethash.EpochLengthECIP1099 != 60000 {
+		t.Errorf("ethash mix bytes %d, ECIP-1099 epoch length %d", descriptor.Ethash.MixBytes, descriptor.Ethash.EpochLengthECIP1099)
+	}
+	if descriptor.Consensus != "ethash" || descriptor.FeeModel != "legacy" {
+		t.Errorf("consensus %q, fee model %q, want ethash and legacy", descriptor.Consensus, descriptor.FeeModel)
+	}
+}
+
+func TestConsensusEngine(t *testing.T) {
+	for _, block := range append([]uint64{0, 1, 20_000_000}, forkBlockIds...) {
+		if engine := ConsensusEngine(new(big.Int).SetUint64(block)); !engine.IsEthash() {
+			t.Errorf("block %d: engine %v, want ethash", block, engine)
+		}
+	}
+	service := testService(19_250_000)
+	for _, block := range []restricted.BlockNumber{0, 19_250_000, restricted.LatestBlockNumber} {
+		if engine, err := service.ConsensusEngine(context.Background(), block); err != nil || engine != "ethash" {
+			t.Errorf("block %d: engine %q (error %v), want ethash", block, engine, err)
+		}
+	}
+}
+
+func TestChainConfig(t *testing.T) {
+	old := backend
+	t.Cleanup(func() { backend = old })
+
+	backend = nil
+	if _, err := new(ClassicService).ChainConfig(context.Background()); err != errNodeNotInitialized {
+		t.Errorf("error %v before initialization, want %v", err, errNodeNotInitialized)
+	}
+
+	db := &testChainDb{values: make(map[string][]byte)}
+	backend = &testRestrictedBackend{db: db}
+	writeChainConfig(backend)
+
+	config, err := new(ClassicService).ChainConfig(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(config, classicChainConfig) {
+		t.Errorf("chain config %s, want %s", config, classicChainConfig)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+)
+
+// EIPActivation describes when, if ever, an EIP activated on this chain.
+type EIPActivation struct {
+	EIP   int    `json:"eip"`
+	Block uint64 `json:"block"`
+	Found bool   `json:"found"`
+}
+
+// eipTransitions maps EIP numbers to the configurator getter returning their
+// activation block.
+func eipTransitions(c *PluginConfigurator) map[int]func() *uint64 {
+	return map[int]func() *uint64{
+		2:    c.GetEIP2Transition,
+		7:    c.GetEIP7Transition,
+		100:  c.GetEthashEIP100BTransition,
+		140:  c.GetEIP140Transition,
+		145:  c.GetEIP145Transition,
+		150:  c.GetEIP150Transition,
+		152:  c.GetEIP152Transition,
+		155:  c.GetEIP155Transition,
+		160:  c.GetEIP160Transition,
+		161:  c.GetEIP161dTransition,
+		170:  c.GetEIP170Transition,
+		198:  c.GetEIP198Transition,
+		211:  c.GetEIP211Transition,
+		212:  c.GetEIP212Transition,
+		213:  c.GetEIP213Transition,
+		214:  c.GetEIP214Transition,
+		658:  c.GetEIP658Transition,
+		1014: c.GetEIP1014Transition,
+		1052: c.GetEIP1052Transition,
+		1108: c.GetEIP1108Transition,
+		1283: c.GetEIP1283Transition,
+		1344: c.GetEIP1344Transition,
+		1884: c.GetEIP1884Transition,
+		2028: c.GetEIP2028Transition,
+		2200: c.GetEIP2200Transition,
+		2565: c.GetEIP2565Transition,
+		2718: c.GetEIP2718Transition,
+		2929: c.GetEIP2929Transition,
+		2930: c.GetEIP2930Transition,
+		3198: c.GetEIP3198Transition,
+		3529: c.GetEIP3529Transition,
+		3541: c.GetEIP3541Transition,
+		3651: c.GetEIP3651Transition,
+		3855: c.GetEIP3855Transition,
+		3860: c.GetEIP3860Transition,
+		6049: c.GetEIP6049Transition,
+	}
+}
+
+// eipActivationBlock returns the block at which the given EIP activates and
+// whether the chain adopted it at all.
+func eipActivationBlock(c *PluginConfigurator, eip int) (uint64, bool) {
+	fn, ok := eipTransitions(c)[eip]
+	if !ok {
+		return 0, false
+	}
+	block := fn()
+	if block == nil {
+		return 0, false
+	}
+	return *block, true
+}
+
+// EIPActivationBlock returns the block at which the given EIP activated on
+// Ethereum Classic. Found is false for EIPs ETC never adopted.
+func (service *ClassicService) EIPActivationBlock(ctx context.Context, eip int) (*EIPActivation, error) {
+	block, found := eipActivationBlock(NewPluginConfig(), eip)
+	return &EIPActivation{EIP: eip, Block: block, Found: found}, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEIPActivationBlock(t *testing.T) {
+	tests := []struct {
+		eip   int
+		block uint64
+		found bool
+	}{
+		{155, 3_000_000, true},
+		{150, 2_500_000, true},
+		{2929, 13_189_133, true},
+		{1559, 0, false},
+		{3675, 0, false},
+	}
+	for _, tt := range tests {
+		result, err := new(ClassicService).EIPActivationBlock(context.Background(), tt.eip)
+		if err != nil {
+			t.Fatalf("EIP-%d: %v", tt.eip, err)
+		}
+		if result.EIP != tt.eip || result.Block != tt.block || result.Found != tt.found {
+			t.Errorf("EIP-%d: activation %d (found %v), want %d (found %v)", tt.eip, result.Block, result.Found, tt.block, tt.found)
+		}
+	}
+}
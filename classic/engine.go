@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"runtime"
 	"errors"
+	"encoding/binary"
 	crand "crypto/rand"
 
 	"golang.org/x/crypto/sha3"
@@ -30,16 +31,36 @@ func CreateEngine(chainConfig *params.ChainConfig, db restricted.Database) conse
 
 	defaultEthash := &Config{
 		CacheDir:         "ethash",
-		CachesInMem:      2,
+		CachesInMem:      *cacheLimit,
 		CachesOnDisk:     3,
 		CachesLockMmap:   false,
 		DatasetsInMem:    1,
 		DatasetsOnDisk:   2,
 		DatasetsLockMmap: false,
+		FutureEpochs:     *futureEpochs,
+		DatasetEviction:  *dagEviction,
+		DatasetBudget:    *dagBudget << 20,
 	}
 
+	switch defaultEthash.DatasetEviction {
+	case evictLRU, evictLFU, evictSize:
+	default:
+		log.Warn("Unknown ethash dataset eviction policy, using lru", "policy", defaultEthash.DatasetEviction)
+		defaultEthash.DatasetEviction = evictLRU
+	}
+
+	log.Info("Ethash verification cache limit", "caches", defaultEthash.CachesInMem)
+
 	defaultEthash.ECIP1099Block = pluginConfig.GetEthashECIP1099Transition()
 
+	// Caches generated before an upgrade across the ECIP-1099 transition may
+	// have been built with the old epoch length, drop them so they are
+	// regenerated with the correct one.
+	if head, ok := headBlockNumber(db); ok {
+		purgeStaleEthashFiles(defaultEthash.CacheDir, "cache", head, defaultEthash.ECIP1099Block)
+		purgeStaleEthashFiles(defaultEthash.DatasetDir, "full", head, defaultEthash.ECIP1099Block)
+	}
+
 	ethHash := New(*defaultEthash, nil, false,)
 
 	ethHash.SetThreads(1) // enable CPU mining with one core
@@ -51,6 +72,23 @@ func CreateEngine(chainConfig *params.ChainConfig, db restricted.Database) conse
 	return ethHash
 }
 
+// headBlockNumber reads the number of the current head header from the chain
+// database, following the rawdb schema.
+func headBlockNumber(db restricted.Database) (uint64, bool) {
+	if db == nil {
+		return 0, false
+	}
+	hash, err := db.Get([]byte("LastHeader"))
+	if err != nil || len(hash) != len(core.Hash{}) {
+		return 0, false
+	}
+	enc, err := db.Get(append([]byte("H"), hash...))
+	if err != nil || len(enc) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(enc), true
+}
+
 // Author implements consensus.Engine, returning the header's coinbase as the
 // proof-of-work verified author of the block.
 func (ethash *Ethash) Author(header *types.Header) (core.Address, error) {
@@ -391,7 +429,11 @@ func (e *Ethash) APIs(chain consensus.ChainHeaderReader) []core.API {
 	return []core.API{}
 }
 
-// Close closes the exit channel to notify all backend threads exiting.
+// Close closes the exit channel to notify all backend threads exiting, and
+// releases the memory mapped caches and datasets.
 func (ethash *Ethash) Close() error {
-	return ethash.StopRemoteSealer()
+	err := ethash.StopRemoteSealer()
+	ethash.caches.purge()
+	ethash.datasets.purge()
+	return err
 }
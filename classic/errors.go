@@ -22,4 +22,8 @@ var (
 	// ErrInvalidTerminalBlock is returned if a block is invalid wrt. the terminal
 	// total difficulty.
 	ErrInvalidTerminalBlock = errors.New("invalid terminal block")
+
+	// ErrInvalidCode is returned if new contract code starts with the 0xEF byte
+	// once EIP-3541 is active.
+	ErrInvalidCode = errors.New("invalid code: must not begin with 0xef")
 )
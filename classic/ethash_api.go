@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// generationStats tracks the ethash caches and datasets generated since
+// startup, as opposed to the ones loaded from disk.
+type generationStats struct {
+	mu           sync.Mutex
+	caches       uint64
+	datasets     uint64
+	lastKind     string
+	lastEpoch    uint64
+	lastDuration time.Duration
+}
+
+var genStats = &generationStats{}
+
+// record registers a finished generation of the given kind.
+func (s *generationStats) record(kind string, epoch uint64, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch kind {
+	case "cache":
+		s.caches++
+	case "dataset":
+		s.datasets++
+	}
+	s.lastKind, s.lastEpoch, s.lastDuration = kind, epoch, elapsed
+}
+
+// GenerationStatsResult reports the ethash generations since startup.
+type GenerationStatsResult struct {
+	CachesGenerated   uint64  `json:"cachesGenerated"`
+	DatasetsGenerated uint64  `json:"datasetsGenerated"`
+	LastKind          string  `json:"lastKind,omitempty"`
+	LastEpoch         uint64  `json:"lastEpoch"`
+	LastDuration      float64 `json:"lastDurationSeconds"`
+}
+
+// GenerationStats returns how many ethash verification caches and mining
+// datasets were generated since startup, along with the epoch and duration
+// of the most recent generation.
+func (service *ClassicService) GenerationStats(ctx context.Context) (*GenerationStatsResult, error) {
+	genStats.mu.Lock()
+	defer genStats.mu.Unlock()
+
+	return &GenerationStatsResult{
+		CachesGenerated:   genStats.caches,
+		DatasetsGenerated: genStats.datasets,
+		LastKind:          genStats.lastKind,
+		LastEpoch:         genStats.lastEpoch,
+		LastDuration:      genStats.lastDuration.Seconds(),
+	}, nil
+}
+
+// dagGenTracker tracks the mining dataset currently being generated, if any.
+type dagGenTracker struct {
+	mu       sync.Mutex
+	epoch    uint64
+	total    uint64
+	progress *atomic.Uint64 // Items generated so far, nil if idle
+}
+
+var dagGen = &dagGenTracker{}
+
+// begin marks the start of a dataset generation of total items.
+func (t *dagGenTracker) begin(epoch, total uint64, progress *atomic.Uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.epoch, t.total, t.progress = epoch, total, progress
+}
+
+// end marks the generation tracked by progress as finished. Generations that
+// were superseded by a newer one are ignored.
+func (t *dagGenTracker) end(progress *atomic.Uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.progress == progress {
+		t.progress = nil
+	}
+}
+
+// DAGGenStatusResult reports whether a mining dataset is being generated.
+type DAGGenStatusResult struct {
+	Active   bool    `json:"active"`
+	Epoch    uint64  `json:"epoch"`
+	Progress float64 `json:"progress"`
+}
+
+// DAGGenerationStatus reports whether a mining dataset (DAG) is currently
+// being generated, for which epoch, and the percentage completed.
+func (service *ClassicService) DAGGenerationStatus(ctx context.Context) (*DAGGenStatusResult, error) {
+	dagGen.mu.Lock()
+	defer dagGen.mu.Unlock()
+
+	if dagGen.progress == nil {
+		return &DAGGenStatusResult{}, nil
+	}
+	result := &DAGGenStatusResult{Active: true, Epoch: dagGen.epoch}
+	if dagGen.total > 0 {
+		result.Progress = float64(dagGen.progress.Load()) * 100 / float64(dagGen.total)
+	}
+	return result, nil
+}
+
+// DAGGenerationEvent is published on the plugin feed as a mining dataset is
+// generated: once when it starts, at every 10% of progress and once it
+// completes. A failed event is published if the dataset could not be written
+// to disk, in which case generation is retried in memory.
+type DAGGenerationEvent struct {
+	Stage      string  `json:"stage"`
+	Epoch      uint64  `json:"epoch"`
+	Percentage uint64  `json:"percentage"`
+	Elapsed    float64 `json:"elapsedSeconds"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// publishDAGEvent sends the event on the plugin feed, if available.
+func publishDAGEvent(event DAGGenerationEvent) {
+	publish(topicDAGGeneration, event)
+}
+
+// EthashParamsResult lists the ethash algorithm parameters, so third party
+// implementations can confirm they are compatible.
+type EthashParamsResult struct {
+	DatasetInitBytes    uint64  `json:"datasetInitBytes"`
+	DatasetGrowthBytes  uint64  `json:"datasetGrowthBytes"`
+	CacheInitBytes      uint64  `json:"cacheInitBytes"`
+	CacheGrowthBytes    uint64  `json:"cacheGrowthBytes"`
+	MixBytes            uint64  `json:"mixBytes"`
+	HashBytes           uint64  `json:"hashBytes"`
+	HashWords           uint64  `json:"hashWords"`
+	DatasetParents      uint64  `json:"datasetParents"`
+	CacheRounds         uint64  `json:"cacheRounds"`
+	LoopAccesses        uint64  `json:"loopAccesses"`
+	EpochLengthDefault  uint64  `json:"epochLengthDefault"`
+	EpochLengthECIP1099 uint64  `json:"epochLengthECIP1099"`
+	ECIP1099Block       *uint64 `json:"ecip1099Block"`
+}
+
+// EthashParams returns the ethash algorithm parameters used by this node.
+func (service *ClassicService) EthashParams(ctx context.Context) (*EthashParamsResult, error) {
+	return &EthashParamsResult{
+		DatasetInitBytes:    datasetInitBytes,
+		DatasetGrowthBytes:  datasetGrowthBytes,
+		CacheInitBytes:      cacheInitBytes,
+		CacheGrowthBytes:    cacheGrowthBytes,
+		MixBytes:            mixBytes,
+		HashBytes:           hashBytes,
+		HashWords:           hashWords,
+		DatasetParents:      datasetParents,
+		CacheRounds:         cacheRounds,
+		LoopAccesses:        loopAccesses,
+		EpochLengthDefault:  epochLengthDefault,
+		EpochLengthECIP1099: epochLengthECIP1099,
+		ECIP1099Block:       NewPluginConfig().GetEthashECIP1099Transition(),
+	}, nil
+}
+
+// CurrentEpoch returns the ethash epoch of the current head, taking the
+// ECIP-1099 epoch length change into account.
+func (service *ClassicService) CurrentEpoch(ctx context.Context) (uint64, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return 0, err
+	}
+	number := head.Number.Uint64()
+	return calcEpoch(number, calcEpochLength(number, NewPluginConfig().GetEthashECIP1099Transition())), nil
+}
+
+// CachedEpoch describes an ethash cache or dataset held in memory. Done is
+// only reported for datasets and tells whether generation has finished.
+type CachedEpoch struct {
+	Epoch       uint64 `json:"epoch"`
+	EpochLength uint64 `json:"epochLength"`
+	Done        *bool  `json:"done,omitempty"`
+}
+
+// CacheStatsResult lists the ethash caches and datasets held in memory, in
+// eviction order with the item evicted last first, along with the ones
+// provisioned for upcoming epochs.
+type CacheStatsResult struct {
+	Caches         []CachedEpoch `json:"caches"`
+	FutureCaches   []CachedEpoch `json:"futureCaches"`
+	Datasets       []CachedEpoch `json:"datasets"`
+	FutureDatasets []CachedEpoch `json:"futureDatasets"`
+}
+
+// cachedEpochs describes the given caches.
+func cachedEpochs(caches []*cache) []CachedEpoch {
+	result := make([]CachedEpoch, 0, len(caches))
+	for _, c := range caches {
+		result = append(result, CachedEpoch{Epoch: c.epoch, EpochLength: c.epochLength})
+	}
+	return result
+}
+
+// datasetEpochs describes the given datasets.
+func datasetEpochs(datasets []*dataset) []CachedEpoch {
+	result := make([]CachedEpoch, 0, len(datasets))
+	for _, d := range datasets {
+		done := d.generated()
+		result = append(result, CachedEpoch{Epoch: d.epoch, EpochLength: d.epochLength, Done: &done})
+	}
+	return result
+}
+
+// sortEpochs orders future items by epoch, as the lru keeps them unordered.
+func sortEpochs(epochs []CachedEpoch) []CachedEpoch {
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i].Epoch < epochs[j].Epoch })
+	return epochs
+}
+
+// CacheStats returns the ethash verification caches and mining datasets
+// currently held in memory.
+func (service *ClassicService) CacheStats(ctx context.Context) (*CacheStatsResult, error) {
+	ethash := eHashForAPI
+	if ethash == nil {
+		return nil, errEngineNotReady
+	}
+	caches, futureCaches := ethash.caches.snapshot()
+	datasets, futureDatasets := ethash.datasets.snapshot()
+	return &CacheStatsResult{
+		Caches:         cachedEpochs(caches),
+		FutureCaches:   sortEpochs(cachedEpochs(futureCaches)),
+		Datasets:       datasetEpochs(datasets),
+		FutureDatasets: sortEpochs(datasetEpochs(futureDatasets)),
+	}, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGenerationStats(t *testing.T) {
+	old := genStats
+	genStats = &generationStats{}
+	t.Cleanup(func() { genStats = old })
+	ethash := newTestEthash(t)
+
+	// Generations of upcoming epochs run in the background, so only lower
+	// bounds are checked.
+	ethash.cache(1).unref()
+	ethash.cache(epochLengthDefault + 1).unref()
+	ethash.dataset(1, false).unref()
+
+	stats, err := new(ClassicService).GenerationStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CachesGenerated < 2 || stats.DatasetsGenerated < 1 {
+		t.Errorf("generated %d caches and %d datasets, want at least 2 and 1", stats.CachesGenerated, stats.DatasetsGenerated)
+	}
+	if stats.LastKind == "" {
+		t.Error("last generation not recorded")
+	}
+}
+
+func TestDAGGenerationStatus(t *testing.T) {
+	old := dagGen
+	dagGen = &dagGenTracker{}
+	t.Cleanup(func() { dagGen = old })
+	service := new(ClassicService)
+
+	if status, _ := service.DAGGenerationStatus(context.Background()); status.Active {
+		t.Errorf("idle tracker reported %+v", status)
+	}
+	var progress atomic.Uint64
+	dagGen.begin(7, 200, &progress)
+	progress.Store(50)
+
+	status, err := service.DAGGenerationStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Active || status.Epoch != 7 || status.Progress != 25 {
+		t.Errorf("status %+v, want active at epoch 7 and 25%%", status)
+	}
+
+	// A superseded generation finishing leaves the newer one reported
+	var newer atomic.Uint64
+	dagGen.begin(8, 100, &newer)
+	dagGen.end(&progress)
+	if status, _ := service.DAGGenerationStatus(context.Background()); !status.Active || status.Epoch != 8 {
+		t.Errorf("status %+v after superseded generation ended, want active at epoch 8", status)
+	}
+	dagGen.end(&newer)
+	if status, _ := service.DAGGenerationStatus(context.Background()); status.Active {
+		t.Errorf("status %+v after generation ended, want idle", status)
+	}
+}
+
+func TestEthashParams(t *testing.T) {
+	params, err := new(ClassicService).EthashParams(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		have, want uint64
+	}{
+		{"datasetInitBytes", params.DatasetInitBytes, datasetInitBytes},
+		{"datasetGrowthBytes", params.DatasetGrowthBytes, datasetGrowthBytes},
+		{"cacheInitBytes", params.CacheInitBytes, cacheInitBytes},
+		{"cacheGrowthBytes", params.CacheGrowthBytes, cacheGrowthBytes},
+		{"mixBytes", params.MixBytes, mixBytes},
+		{"hashBytes", params.HashBytes, hashBytes},
+		{"hashWords", params.HashWords, hashWords},
+		{"datasetParents", params.DatasetParents, datasetParents},
+		{"cacheRounds", params.CacheRounds, cacheRounds},
+		{"loopAccesses", params.LoopAccesses, loopAccesses},
+		{"epochLengthDefault", params.EpochLengthDefault, epochLengthDefault},
+		{"epochLengthECIP1099", params.EpochLengthECIP1099, epochLengthECIP1099},
+	}
+	for _, tt := range tests {
+		if tt.have != tt.want {
+			t.Errorf("%s: have %d, want %d", tt.name, tt.have, tt.want)
+		}
+	}
+	// The constants themselves must follow the ethash specification
+	if mixBytes != 128 || hashBytes != 64 || hashWords != 16 || datasetParents != 256 || cacheRounds != 3 || loopAccesses != 64 {
+		t.Error("ethash constants deviate from the specification")
+	}
+	if params.ECIP1099Block == nil || *params.ECIP1099Block != 11_700_000 {
+		t.Errorf("ECIP-1099 block %v, want 11700000", params.ECIP1099Block)
+	}
+}
+
+func TestCurrentEpoch(t *testing.T) {
+	tests := []struct {
+		head int64
+		want uint64
+	}{
+		{11_699_999, 389}, // 30000 block epochs before ECIP-1099
+		{11_700_000, 195}, // 60000 block epochs from block 11,700,000
+		{19_250_000, 320},
+		{20_000_000, 333},
+	}
+	for _, tt := range tests {
+		epoch, err := testService(tt.head).CurrentEpoch(context.Background())
+		if err != nil {
+			t.Fatalf("head %d: %v", tt.head, err)
+		}
+		if epoch != tt.want {
+			t.Errorf("head %d: epoch %d, want %d", tt.head, epoch, tt.want)
+		}
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	ethash := newTestEthash(t)
+
+	// Seed the lrus without generating anything: epochs 0 and 1 are cached,
+	// the dataset of epoch 1 finished generating.
+	for _, epoch := range []uint64{0, 1} {
+		c, _ := ethash.caches.get(epoch, epochLengthDefault, nil)
+		c.unref()
+	}
+	d, _ := ethash.datasets.get(1, epochLengthDefault, nil)
+	d.done.Store(true)
+	d.unref()
+
+	stats, err := new(ClassicService).CacheStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameEpochs(stats.Caches, 1, 0) || !sameEpochs(stats.FutureCaches, 2) {
+		t.Errorf("caches %+v, future %+v, want epochs [1 0] and [2]", stats.Caches, stats.FutureCaches)
+	}
+	if !sameEpochs(stats.Datasets, 1) || !sameEpochs(stats.FutureDatasets, 2) {
+		t.Fatalf("datasets %+v, future %+v, want epochs [1] and [2]", stats.Datasets, stats.FutureDatasets)
+	}
+	if done := stats.Datasets[0].Done; done == nil || !*done {
+		t.Error("generated dataset not reported as done")
+	}
+	if done := stats.FutureDatasets[0].Done; done == nil || *done {
+		t.Error("future dataset reported as done")
+	}
+	for _, c := range stats.Caches {
+		if c.EpochLength != epochLengthDefault || c.Done != nil {
+			t.Errorf("cache %+v, want epoch length %d without done flag", c, epochLengthDefault)
+		}
+	}
+
+	eHashForAPI = nil
+	if _, err := new(ClassicService).CacheStats(context.Background()); err != errEngineNotReady {
+		t.Errorf("error %v without an engine, want %v", err, errEngineNotReady)
+	}
+}
+
+// sameEpochs reports whether items holds exactly the given epochs, in order.
+func sameEpochs(items []CachedEpoch, epochs ...uint64) bool {
+	if len(items) != len(epochs) {
+		return false
+	}
+	for i, item := range items {
+		if item.Epoch != epochs[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -30,6 +30,19 @@ type Config struct {
 	DatasetsLockMmap bool
 	PowMode          Mode
 
+	// FutureEpochs is the number of epochs ahead of the current one for which
+	// caches and datasets are pre-generated. Values below one mean one.
+	FutureEpochs int
+
+	// DatasetEviction selects how in-memory datasets are evicted, either "lru"
+	// (default), "lfu" or "size". Verification caches are always evicted by
+	// recency.
+	DatasetEviction string
+
+	// DatasetBudget is the total size in bytes of the in-memory datasets kept
+	// under the "size" eviction policy, which ignores DatasetsInMem.
+	DatasetBudget uint64
+
 	// When set, notifications sent by the remote sealer will
 	// be block header JSON objects instead of work package arrays.
 	NotifyFull bool
@@ -137,8 +150,8 @@ func New(config Config, notify []string, noverify bool) *Ethash {
 	}
 	ethash := &Ethash{
 		config:   config,
-		caches:   newlru(config.CachesInMem, newCache),
-		datasets: newlru(config.DatasetsInMem, newDataset),
+		caches:   newlru(config.CachesInMem, config.FutureEpochs, evictLRU, 0, newCache),
+		datasets: newlru(config.DatasetsInMem, config.FutureEpochs, config.DatasetEviction, config.DatasetBudget, newDataset),
 		update:   make(chan struct{}),
 		// hashrate: metrics.NewMeterForced(),
 	}
@@ -165,13 +178,8 @@ func (ethash *Ethash) verifyHeader(chain ChainHeaderReader, header, parent *type
 		return fmt.Errorf("extra-data too long: %d > %d", len(header.Extra), MaximumExtraDataSize)
 	}
 	// Verify the header's timestamp
-	if !uncle {
-		if header.Time > uint64(unixNow+int64(allowedFutureBlockTime.Seconds())) {
-			return ErrFutureBlock
-		}
-	}
-	if header.Time <= parent.Time {
-		return errOlderBlockTime
+	if err := verifyTimestamp(parent, header, unixNow, !uncle); err != nil {
+		return err
 	}
 	// Verify the block's difficulty based on its timestamp and parent's difficulty
 	expected := ethash.CalcDifficulty(chain, header.Time, parent)
@@ -205,6 +213,26 @@ func (ethash *Ethash) verifyHeader(chain ChainHeaderReader, header, parent *type
 	return nil
 }
 
+// VerifyTimestamp checks that the header's timestamp is strictly greater than
+// its parent's and not further in the future than allowedFutureBlockTime.
+func VerifyTimestamp(parent, header *types.Header) error {
+	return verifyTimestamp(parent, header, time.Now().Unix(), true)
+}
+
+// verifyTimestamp checks the timestamp monotonicity rule and, if checkFuture
+// is set, that the header is not too far ahead of unixNow.
+func verifyTimestamp(parent, header *types.Header, unixNow int64, checkFuture bool) error {
+	if checkFuture {
+		if header.Time > uint64(unixNow+int64(allowedFutureBlockTime.Seconds())) {
+			return ErrFutureBlock
+		}
+	}
+	if header.Time <= parent.Time {
+		return errOlderBlockTime
+	}
+	return nil
+}
+
 func (ethash *Ethash) verifyHeaderWorker(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool, index int, unixNow int64) error {
 	var parent *types.Header
 	if index == 0 {
@@ -249,6 +277,7 @@ func (ethash *Ethash) verifySeal(chain ChainHeaderReader, header *types.Header,
 	// If fast-but-heavy PoW verification was requested, use an ethash dataset
 	if fulldag {
 		dataset := ethash.dataset(number, true)
+		defer dataset.unref()
 		if dataset.generated() {
 			digest, result = hashimotoFull(dataset.dataset, ethash.SealHash(header).Bytes(), header.Nonce.Uint64())
 
@@ -263,6 +292,7 @@ func (ethash *Ethash) verifySeal(chain ChainHeaderReader, header *types.Header,
 	// If slow-but-light PoW verification was requested (or DAG not yet ready), use an ethash cache
 	if !fulldag {
 		cache := ethash.cache(number)
+		defer cache.unref()
 		epochLength := calcEpochLength(number, ethash.config.ECIP1099Block)
 		epoch := calcEpoch(number, epochLength)
 		size := datasetSize(epoch)
@@ -276,6 +306,34 @@ func (ethash *Ethash) verifySeal(chain ChainHeaderReader, header *types.Header,
 		runtime.KeepAlive(cache)
 	}
 	// Verify the calculated values against the ones provided in the header
+	return verifyPoWResult(header, digest, result)
+}
+
+// verifySealLight checks whether a header satisfies the PoW difficulty
+// requirements using the supplied verification cache, which must belong to
+// the header's epoch.
+func (ethash *Ethash) verifySealLight(header *types.Header, cache *cache) error {
+	if header.Difficulty.Sign() <= 0 {
+		return errInvalidDifficulty
+	}
+	number := header.Number.Uint64()
+	epochLength := calcEpochLength(number, ethash.config.ECIP1099Block)
+	size := datasetSize(calcEpoch(number, epochLength))
+	if ethash.config.PowMode == ModeTest {
+		size = 32 * 1024
+	}
+	digest, result := hashimotoLight(size, cache.cache, ethash.SealHash(header).Bytes(), header.Nonce.Uint64())
+
+	// Caches are unmapped in a finalizer. Ensure that the cache stays alive
+	// until after the call to hashimotoLight so it's not unmapped while being used.
+	runtime.KeepAlive(cache)
+
+	return verifyPoWResult(header, digest, result)
+}
+
+// verifyPoWResult compares the computed mix digest and PoW result against the
+// header's mix digest and difficulty target.
+func verifyPoWResult(header *types.Header, digest, result []byte) error {
 	if !bytes.Equal(header.MixDigest[:], digest) {
 		return errInvalidMixDigest
 	}
@@ -291,7 +349,8 @@ func (ethash *Ethash) verifySeal(chain ChainHeaderReader, header *types.Header,
 // stored on disk, and finally generating one if none can be found.
 //
 // If async is specified, not only the future but the current DAG is also
-// generates on a background thread.
+// generates on a background thread. The caller must unref the returned dataset
+// once done with it.
 func (ethash *Ethash) dataset(block uint64, async bool) *dataset {
 	// Retrieve the requested ethash dataset
 	epochLength := calcEpochLength(block, ethash.config.ECIP1099Block)
@@ -307,15 +366,19 @@ func (ethash *Ethash) dataset(block uint64, async bool) *dataset {
 	if async && !current.generated() {
 		go func() {
 			current.generate(ethash.config.DatasetDir, ethash.config.DatasetsOnDisk, ethash.config.DatasetsLockMmap, ethash.config.PowMode == ModeTest)
-			if future != nil {
-				future.generate(ethash.config.DatasetDir, ethash.config.DatasetsOnDisk, ethash.config.DatasetsLockMmap, ethash.config.PowMode == ModeTest)
+			for _, d := range future {
+				d.generate(ethash.config.DatasetDir, ethash.config.DatasetsOnDisk, ethash.config.DatasetsLockMmap, ethash.config.PowMode == ModeTest)
 			}
 		}()
 	} else {
 		// Either blocking generation was requested, or already done
 		current.generate(ethash.config.DatasetDir, ethash.config.DatasetsOnDisk, ethash.config.DatasetsLockMmap, ethash.config.PowMode == ModeTest)
-		if future != nil {
-			go future.generate(ethash.config.DatasetDir, ethash.config.DatasetsOnDisk, ethash.config.DatasetsLockMmap, ethash.config.PowMode == ModeTest)
+		if len(future) > 0 {
+			go func() {
+				for _, d := range future {
+					d.generate(ethash.config.DatasetDir, ethash.config.DatasetsOnDisk, ethash.config.DatasetsLockMmap, ethash.config.PowMode == ModeTest)
+				}
+			}()
 		}
 	}
 	return current
@@ -323,7 +386,8 @@ func (ethash *Ethash) dataset(block uint64, async bool) *dataset {
 
 // cache tries to retrieve a verification cache for the specified block number
 // by first checking against a list of in-memory caches, then against caches
-// stored on disk, and finally generating one if none can be found.
+// stored on disk, and finally generating one if none can be found. The caller
+// must unref the returned cache once done with it.
 func (ethash *Ethash) cache(block uint64) *cache {
 	// var num *uint64
 	// bi := big.NewInt(11700000).Uint64()
@@ -335,13 +399,22 @@ func (ethash *Ethash) cache(block uint64) *cache {
 	// Wait for generation finish.
 	current.generate(ethash.config.CacheDir, ethash.config.CachesOnDisk, ethash.config.CachesLockMmap, ethash.config.PowMode == ModeTest)
 
-	// If we need a new future cache, now's a good time to regenerate it.
-	if future != nil {
-		go future.generate(ethash.config.CacheDir, ethash.config.CachesOnDisk, ethash.config.CachesLockMmap, ethash.config.PowMode == ModeTest)
+	// If we need new future caches, now's a good time to regenerate them.
+	if len(future) > 0 {
+		go func() {
+			for _, c := range future {
+				c.generate(ethash.config.CacheDir, ethash.config.CachesOnDisk, ethash.config.CachesLockMmap, ethash.config.PowMode == ModeTest)
+			}
+		}()
 	}
 	return current
 }
 
+// generated returns whether this particular cache finished generating already.
+func (c *cache) generated() bool {
+	return c.done.Load()
+}
+
 // generated returns whether this particular dataset finished generating already
 // or not (it may not have been started at all). This is useful for remote miners
 // to default to verification caches instead of blocking on DAG generations.
@@ -349,10 +422,21 @@ func (d *dataset) generated() bool {
 	return d.done.Load()
 }
 
+// size returns the memory taken by the cache once generated.
+func (c *cache) size() uint64 {
+	return cacheSize(c.epoch)
+}
+
+// size returns the memory taken by the dataset once generated.
+func (d *dataset) size() uint64 {
+	return datasetSize(d.epoch)
+}
+
 // get retrieves or creates an item for the given epoch. The first return value is always
-// non-nil. The second return value is non-nil if lru thinks that an item will be useful in
-// the near future.
-func (lru *lru[T]) get(epoch uint64, epochLength uint64, ecip1099FBlock *uint64) (item, future T) {
+// non-nil and referenced on behalf of the caller, who must unref it once done. The second
+// return value holds the items lru thinks will be useful in the near future and which
+// have not been handed out before.
+func (lru *lru[T]) get(epoch uint64, epochLength uint64, ecip1099FBlock *uint64) (item T, future []T) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
@@ -363,16 +447,50 @@ func (lru *lru[T]) get(epoch uint64, epochLength uint64, ecip1099FBlock *uint64)
 	// Get or create the item for the requested epoch.
 	item, ok := lru.cache.Get(cacheKey)
 	if !ok {
-		if lru.future > 0 && lru.future == epoch {
-			item = lru.futureItem
+		if futureItem, ok := lru.futureItems[cacheKey]; ok {
+			item = futureItem
 		} else {
 			log.Trace("Requiring new ethash "+lru.what, "epoch", epoch)
-			item = lru.new(epoch, epochLength)
+			item = lru.create(cacheKey, epoch, epochLength)
 		}
 		lru.cache.Add(cacheKey, item)
 	}
+	item.ref()
+
+	// Update the 'future items' to cover the look-ahead window following this
+	// epoch, dropping any provisioned for epochs no longer in the window.
+	futureItems := make(map[uint64]T, lru.lookahead)
+	if epoch < maxEpoch-1 {
+		nextEpoch, nextEpochLength := epoch, epochLength
+		for i := 0; i < lru.lookahead; i++ {
+			nextEpoch, nextEpochLength = calcNextEpoch(nextEpoch, nextEpochLength, ecip1099FBlock)
+			key := nextEpochLength + nextEpoch
+			if lru.cache.Contains(key) {
+				continue
+			}
+			if futureItem, ok := lru.futureItems[key]; ok {
+				futureItems[key] = futureItem
+				continue
+			}
+			log.Trace("Requiring new future ethash "+lru.what, "epoch", nextEpoch)
+			futureItem := lru.create(key, nextEpoch, nextEpochLength)
+			futureItems[key] = futureItem
+			future = append(future, futureItem)
+		}
+	}
+	// Release the items that fell out of the look-ahead window without being used.
+	for key, futureItem := range lru.futureItems {
+		if _, ok := futureItems[key]; !ok && !lru.cache.Contains(key) {
+			futureItem.release()
+		}
+	}
+	lru.futureItems = futureItems
+	return item, future
+}
 
-	// Ensure pre-generation handles ecip-1099 changeover correctly
+// calcNextEpoch returns the epoch and epoch length following the given one,
+// handling the ECIP-1099 changeover correctly.
+func calcNextEpoch(epoch uint64, epochLength uint64, ecip1099FBlock *uint64) (uint64, uint64) {
 	var nextEpoch = epoch + 1
 	var nextEpochLength = epochLength
 	if ecip1099FBlock != nil {
@@ -385,22 +503,25 @@ func (lru *lru[T]) get(epoch uint64, epochLength uint64, ecip1099FBlock *uint64)
 			nextEpochLength = epochLengthECIP1099
 		}
 	}
-
-	// Update the 'future item' if epoch is larger than previously seen.
-	// Last conditional clause ('lru.future > nextEpoch') handles the ECIP1099 case where
-	// the next epoch is expected to be LESSER THAN that of the previous state's future epoch number.
-	if epoch < maxEpoch-1 && lru.future != nextEpoch {
-		log.Trace("Requiring new future ethash "+lru.what, "epoch", nextEpoch)
-		future = lru.new(nextEpoch, nextEpochLength)
-		lru.future = nextEpoch
-		lru.futureItem = future
-	}
-	return item, future
+	return nextEpoch, nextEpochLength
 }
 
 // generate ensures that the cache content is generated before use.
 func (c *cache) generate(dir string, limit int, lock bool, test bool) {
 	c.once.Do(func() {
+		// Drop the generator's reference after marking the cache generated.
+		defer c.unref()
+		defer c.done.Store(true)
+
+		var (
+			start     = time.Now()
+			generated bool
+		)
+		defer func() {
+			if generated {
+				genStats.record("cache", c.epoch, time.Since(start))
+			}
+		}()
 		size := cacheSize(c.epoch)
 		seed := seedHash(c.epoch, c.epochLength)
 		if test {
@@ -408,6 +529,7 @@ func (c *cache) generate(dir string, limit int, lock bool, test bool) {
 		}
 		// If we don't store anything on disk, generate and return.
 		if dir == "" {
+			generated = true
 			c.cache = make([]uint32, size/4)
 			generateCache(c.cache, c.epoch, c.epochLength, seed)
 			return
@@ -437,6 +559,7 @@ func (c *cache) generate(dir string, limit int, lock bool, test bool) {
 			return
 		}
 		log.Debug("Failed to load old ethash cache", "err", err)
+		generated = true
 
 		// No usable previous cache available, create a new cache file to fill
 		c.dump, c.mmap, c.cache, err = memoryMapAndGenerate(path, size, lock, func(buffer []uint32) { generateCache(buffer, c.epoch, c.epochLength, seed) })
@@ -481,9 +604,21 @@ func (c *cache) generate(dir string, limit int, lock bool, test bool) {
 // generate ensures that the dataset content is generated before use.
 func (d *dataset) generate(dir string, limit int, lock bool, test bool) {
 	d.once.Do(func() {
+		// Drop the generator's reference after marking the dataset generated.
+		defer d.unref()
 		// Mark the dataset generated after we're done. This is needed for remote
 		defer d.done.Store(true)
 
+		var (
+			start     = time.Now()
+			generated bool
+		)
+		defer func() {
+			if generated {
+				genStats.record("dataset", d.epoch, time.Since(start))
+			}
+		}()
+
 		csize := cacheSize(d.epoch)
 		dsize := datasetSize(d.epoch)
 		seed := seedHash(d.epoch, d.epochLength)
@@ -493,6 +628,7 @@ func (d *dataset) generate(dir string, limit int, lock bool, test bool) {
 		}
 		// If we don't store anything on disk, generate and return
 		if dir == "" {
+			generated = true
 			cache := make([]uint32, csize/4)
 			generateCache(cache, d.epoch, d.epochLength, seed)
 
@@ -521,14 +657,18 @@ func (d *dataset) generate(dir string, limit int, lock bool, test bool) {
 			return
 		}
 		log.Debug("Failed to load old ethash dataset", "err", err)
+		generated = true
 
 		// No usable previous dataset available, create a new dataset file to fill
 		cache := make([]uint32, csize/4)
 		generateCache(cache, d.epoch, d.epochLength, seed)
 
-		d.dump, d.mmap, d.dataset, err = memoryMapAndGenerate(path, dsize, lock, func(buffer []uint32) { generateDataset(buffer, d.epoch, d.epochLength, cache) })
+		d.dump, d.mmap, d.dataset, err = memoryMapAndGenerate(path, dsize, lock, func(buffer []uint32) {
+			generateDatasetThrottled(buffer, d.epoch, d.epochLength, cache, newIOThrottle(*dagIOLimit))
+		})
 		if err != nil {
 			log.Error("Failed to generate mapped ethash dataset", "err", err)
+			publishDAGEvent(DAGGenerationEvent{Stage: "failed", Epoch: d.epoch, Elapsed: time.Since(start).Seconds(), Error: err.Error()})
 
 			d.dataset = make([]uint32, dsize/4)
 			generateDataset(d.dataset, d.epoch, d.epochLength, cache)
@@ -609,4 +749,40 @@ func CalcEpochLength(block uint64, ecip1099FBlock *uint64) uint64 {
 // CalcEpoch returns the epoch for a given block number (ECIP-1099)
 func CalcEpoch(block uint64, epochLength uint64) uint64 {
 	return calcEpoch(block, epochLength)
-}
\ No newline at end of file
+}
+// purgeStaleEthashFiles removes the cache or dataset files (selected by kind,
+// "cache" or "full") in dir whose seed does not match the epoch length in use
+// at the head block. Such files were generated with a different epoch length,
+// e.g. before an upgrade across the ECIP-1099 transition. It returns the number
+// of files removed.
+func purgeStaleEthashFiles(dir string, kind string, head uint64, ecip1099FBlock *uint64) int {
+	if dir == "" {
+		return 0
+	}
+	var endian string
+	if !isLittleEndian() {
+		endian = ".be"
+	}
+	epochLength := calcEpochLength(head, ecip1099FBlock)
+
+	matches, _ := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%s-R%d-*", kind, algorithmRevision)))
+	var removed int
+	for _, file := range matches {
+		var ar int   // algorithm revision
+		var e uint64 // epoch
+		var s string // seed
+		if _, err := fmt.Sscanf(filepath.Base(file), kind+"-R%d-%d-%s"+endian, &ar, &e, &s); err != nil {
+			continue
+		}
+		if s == fmt.Sprintf("%x", seedHash(e, epochLength)[:8]) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			log.Error("Failed to delete stale ethash file", "epoch", e, "epochLength", epochLength, "file", file, "err", err)
+			continue
+		}
+		log.Warn("Deleted ethash file generated with a stale epoch length", "epoch", e, "epochLength", epochLength, "file", file)
+		removed++
+	}
+	return removed
+}
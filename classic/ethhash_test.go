@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+func TestVerifyTimestamp(t *testing.T) {
+	now := time.Now().Unix()
+	parent := &types.Header{Time: uint64(now - 20)}
+	tests := []struct {
+		name string
+		time int64
+		err  error
+	}{
+		{"increasing", now - 5, nil},
+		{"equal", now - 20, errOlderBlockTime},
+		{"earlier", now - 30, errOlderBlockTime},
+		{"slightly ahead", now + 5, nil},
+		{"far future", now + 3600, ErrFutureBlock},
+	}
+	for _, tt := range tests {
+		if err := VerifyTimestamp(parent, &types.Header{Time: uint64(tt.time)}); err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestPurgeStaleEthashFiles(t *testing.T) {
+	var (
+		ecip1099 = uint64(11_700_000)
+		head     = uint64(12_000_000) // Epochs of 60000 blocks
+		dir      = t.TempDir()
+	)
+	endian := ""
+	if !isLittleEndian() {
+		endian = ".be"
+	}
+	name := func(kind string, epoch, epochLength uint64) string {
+		return fmt.Sprintf("%s-R%d-%d-%x%s", kind, algorithmRevision, epoch, seedHash(epoch, epochLength)[:8], endian)
+	}
+	var (
+		fresh = []string{name("cache", 200, 60000), name("full", 200, 60000)}
+		stale = []string{name("cache", 400, 30000), name("cache", 401, 30000), name("full", 400, 30000)}
+	)
+	for _, file := range append(append([]string{}, fresh...), stale...) {
+		if err := os.WriteFile(filepath.Join(dir, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed := purgeStaleEthashFiles(dir, "cache", head, &ecip1099)
+	removed += purgeStaleEthashFiles(dir, "full", head, &ecip1099)
+	if removed != len(stale) {
+		t.Errorf("removed %d files, want %d", removed, len(stale))
+	}
+	for _, file := range stale {
+		if _, err := os.Stat(filepath.Join(dir, file)); !os.IsNotExist(err) {
+			t.Errorf("stale file %s kept", file)
+		}
+	}
+	for _, file := range fresh {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("file %s generated with the current epoch length: %v", file, err)
+		}
+	}
+
+	// Before the transition the old epoch length is current
+	if removed := purgeStaleEthashFiles(dir, "cache", ecip1099-1, &ecip1099); removed != 1 {
+		t.Errorf("removed %d files before the transition, want 1", removed)
+	}
+}
+
+func TestEpochContinuityECIP1099(t *testing.T) {
+	activation := uint64(11_700_000)
+	tests := []struct {
+		block       uint64
+		epochLength uint64
+		epoch       uint64
+	}{
+		{11_669_999, 30000, 388},
+		{11_670_000, 30000, 389},
+		{11_699_999, 30000, 389},
+		{11_700_000, 60000, 195},
+		{11_759_999, 60000, 195},
+		{11_760_000, 60000, 196},
+	}
+	var lastSeedBlock uint64
+	for _, tt := range tests {
+		epochLength := CalcEpochLength(tt.block, &activation)
+		epoch := CalcEpoch(tt.block, epochLength)
+		if epochLength != tt.epochLength || epoch != tt.epoch {
+			t.Errorf("block %d: epoch %d of %d blocks, want %d of %d", tt.block, epoch, epochLength, tt.epoch, tt.epochLength)
+		}
+		// The seed, one hash per 30000 blocks, never skips or repeats across
+		// the transition: the epoch starts at or before the block and its
+		// successor after it.
+		seedBlock := calcEpochBlock(epoch, epochLength)
+		if seedBlock > tt.block+1 || seedBlock+epochLength <= tt.block+1 {
+			t.Errorf("block %d: epoch %d covers blocks from %d", tt.block, epoch, seedBlock)
+		}
+		if seedBlock < lastSeedBlock {
+			t.Errorf("block %d: epoch starting at %d precedes the previous one at %d", tt.block, seedBlock, lastSeedBlock)
+		}
+		lastSeedBlock = seedBlock
+	}
+	if epoch, epochLength := calcNextEpoch(389, 30000, &activation); epoch != 195 || epochLength != 60000 {
+		t.Errorf("epoch after 389: %d of %d blocks, want 195 of 60000", epoch, epochLength)
+	}
+	if !bytes.Equal(seedHash(195, 60000), seedHash(390, 30000)) {
+		t.Error("first ECIP-1099 epoch does not continue the seed of the epoch it replaces")
+	}
+}
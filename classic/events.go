@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+)
+
+// Topics of the events published on the plugin feed.
+const (
+	topicDeepReorg     = "deepReorg"
+	topicDAGGeneration = "dagGeneration"
+)
+
+// ClassicEvent is the only type sent on the plugin feed. The feed is typed by
+// the first value sent on it and panics on any other type, so every event is
+// wrapped in a ClassicEvent and told apart by its Topic.
+type ClassicEvent struct {
+	Topic   string      `json:"topic"`
+	Payload interface{} `json:"payload"`
+}
+
+// publish sends payload on the plugin feed under the given topic, if the feed
+// is available.
+func publish(topic string, payload interface{}) {
+	if events != nil {
+		events.Send(ClassicEvent{Topic: topic, Payload: payload})
+	}
+}
+
+// EventTopic describes a kind of event the plugin publishes on its feed.
+// Subscribers receive every event as a ClassicEvent and tell them apart by
+// its Topic, matching Name. Type names the Go type of the event's Payload.
+type EventTopic struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// eventTopics lists every event published on the plugin feed.
+var eventTopics = []EventTopic{
+	{
+		Name:        topicDeepReorg,
+		Type:        "DeepReorgEvent",
+		Description: "A chain reorganisation deeper than --classic.maxsafereorg occurred",
+	},
+	{
+		Name:        topicDAGGeneration,
+		Type:        "DAGGenerationEvent",
+		Description: "Mining dataset generation started, progressed by 10%, completed or failed to write to disk",
+	},
+}
+
+// EventTopics lists the events the plugin publishes on its feed.
+func (service *ClassicService) EventTopics(ctx context.Context) ([]EventTopic, error) {
+	return append([]EventTopic{}, eventTopics...), nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// testFeed records the values sent on it and, like the host's typed feed,
+// panics when a value of a different type than the first one is sent.
+type testFeed struct {
+	mu   sync.Mutex
+	typ  reflect.Type
+	sent []interface{}
+}
+
+func (f *testFeed) Send(value interface{}) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.typ == nil {
+		f.typ = reflect.TypeOf(value)
+	} else if typ := reflect.TypeOf(value); typ != f.typ {
+		panic(fmt.Sprintf("feed of type %v cannot send %v", f.typ, typ))
+	}
+	f.sent = append(f.sent, value)
+	return 1
+}
+
+func (f *testFeed) Subscribe(channel interface{}) core.Subscription {
+	panic("not implemented")
+}
+
+// published returns the events sent on the feed for the given topic.
+func (f *testFeed) published(topic string) []interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var payloads []interface{}
+	for _, value := range f.sent {
+		if event := value.(ClassicEvent); event.Topic == topic {
+			payloads = append(payloads, event.Payload)
+		}
+	}
+	return payloads
+}
+
+// withTestFeed replaces the plugin feed for the duration of the test.
+func withTestFeed(t *testing.T) *testFeed {
+	feed := new(testFeed)
+	old := events
+	events = feed
+	t.Cleanup(func() { events = old })
+	return feed
+}
+
+func TestDAGGenerationEvents(t *testing.T) {
+	feed := withTestFeed(t)
+
+	cache := make([]uint32, 1024/4)
+	generateCache(cache, 0, epochLengthDefault, seedHash(0, epochLengthDefault))
+	dataset := make([]uint32, 32*1024/4)
+	generateDatasetThrottled(dataset, 0, epochLengthDefault, cache, nil)
+
+	payloads := feed.published(topicDAGGeneration)
+	if len(payloads) != 11 {
+		t.Fatalf("published %d events, want 11", len(payloads))
+	}
+	first, last := payloads[0].(DAGGenerationEvent), payloads[len(payloads)-1].(DAGGenerationEvent)
+	if first.Stage != "started" {
+		t.Errorf("first stage %q, want started", first.Stage)
+	}
+	if last.Stage != "completed" || last.Percentage != 100 {
+		t.Errorf("last event %+v, want completed at 100%%", last)
+	}
+	seen := make(map[uint64]bool)
+	for _, payload := range payloads[1 : len(payloads)-1] {
+		event := payload.(DAGGenerationEvent)
+		if event.Stage != "progress" {
+			t.Errorf("stage %q, want progress", event.Stage)
+		}
+		seen[event.Percentage] = true
+	}
+	for percentage := uint64(10); percentage < 100; percentage += 10 {
+		if !seen[percentage] {
+			t.Errorf("missing progress event at %d%%", percentage)
+		}
+	}
+}
+
+func TestDAGGenerationCycle(t *testing.T) {
+	feed := withTestFeed(t)
+
+	// One generation of a test sized dataset, as the engine runs it
+	d := newDataset(1, epochLengthDefault)
+	d.ref()
+	d.generate("", 0, false, true)
+	if !d.generated() {
+		t.Fatal("dataset not generated")
+	}
+
+	payloads := feed.published(topicDAGGeneration)
+	if len(payloads) == 0 {
+		t.Fatal("no events published")
+	}
+	first, last := payloads[0].(DAGGenerationEvent), payloads[len(payloads)-1].(DAGGenerationEvent)
+	if first.Stage != "started" || first.Epoch != 1 {
+		t.Errorf("first event %+v, want started for epoch 1", first)
+	}
+	if last.Stage != "completed" || last.Epoch != 1 || last.Elapsed < 0 {
+		t.Errorf("last event %+v, want completed for epoch 1", last)
+	}
+}
+
+func TestEventTopics(t *testing.T) {
+	topics, err := new(ClassicService).EventTopics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		topicDeepReorg:     reflect.TypeOf(DeepReorgEvent{}).Name(),
+		topicDAGGeneration: reflect.TypeOf(DAGGenerationEvent{}).Name(),
+	}
+	for _, topic := range topics {
+		if typ, ok := want[topic.Name]; !ok {
+			t.Errorf("unexpected topic %q", topic.Name)
+		} else if topic.Type != typ {
+			t.Errorf("topic %q has payload type %q, want %q", topic.Name, topic.Type, typ)
+		} else if topic.Description == "" {
+			t.Errorf("topic %q has no description", topic.Name)
+		}
+		delete(want, topic.Name)
+	}
+	for name := range want {
+		t.Errorf("missing topic %q", name)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+// Flags holds the command line options specific to the Classic plugin. They
+// are parsed by the ParseFlags hook before Initialize is called.
+var Flags = *flag.NewFlagSet("classic", flag.ContinueOnError)
+
+var (
+	ethashSelfCheck    = Flags.Bool("classic.ethashselfcheck", false, "Verify the ethash cache and dataset size constants at startup")
+	futureEpochs       = Flags.Int("classic.futureepochs", 1, "Number of upcoming ethash epochs to pre-generate caches and datasets for")
+	maxSafeReorg       = Flags.Uint64("classic.maxsafereorg", 0, "Reorg depth above which a deep reorg alert is raised (0 disables the check)")
+	reorgDegrade       = Flags.Bool("classic.reorgdegrade", false, "Report the node as degraded after a deep reorg until the alert is cleared")
+	dagIOLimit         = Flags.Int("classic.dagiolimit", 0, "Maximum rate in MB/s at which ethash datasets are written to disk (0 = unlimited)")
+	cacheLimit         = Flags.Int("classic.cachelimit", 2, "Maximum number of ethash verification caches kept in memory")
+	dagEviction        = Flags.String("classic.dagevict", "lru", "Eviction policy for in-memory ethash datasets (lru: least recently used, lfu: least frequently used, size: least recently used beyond --classic.dagbudget)")
+	dagBudget          = Flags.Uint64("classic.dagbudget", 4096, "Memory budget in MB for in-memory ethash datasets with --classic.dagevict=size")
+	maxConcurrentRPC   = Flags.Int("classic.maxconcurrentrpc", 0, "Maximum number of heavy RPC calls (PoW verification, state replays) executed concurrently (0 = unlimited)")
+	configPath         = Flags.String("classic.config", "", "Path to a JSON chain config to store instead of the embedded Classic config")
+	genesisHash        = Flags.String("classic.genesis", "", "Genesis hash to store the chain config under (defaults to the node's genesis block)")
+	startupSummary     = Flags.Bool("classic.startupsummary", true, "Log a summary of the effective plugin configuration at startup")
+	forkIDsFlag        = Flags.String("classic.forkids", "", "Comma separated, increasing list of fork blocks to advertise in the fork ID instead of the Classic schedule")
+	checkBootnodesFlag = Flags.Bool("classic.checkbootnodes", false, "Dial the bootnodes at startup and drop the unreachable ones")
+	bootnodeTimeout    = Flags.Duration("classic.bootnodetimeout", 3*time.Second, "Maximum time the bootnode check started by --classic.checkbootnodes may take")
+	networkIDFlag      = Flags.Uint64("classic.networkid", 1, "Network ID to advertise to peers, for private networks derived from Classic")
+	forkCheckURL       = Flags.String("classic.forkcheck", "", "URL of a trusted JSON fork schedule ({\"forkBlocks\": [...], \"forkTimes\": [...]}) the plugin's schedule must match for the node to start")
+	rpcAllowlist       = Flags.String("classic.rpcapis", "plugeth,plugeth_trimRewardCache,plugeth_verifyHeader,eth,admin_clearReorgAlert", "Comma separated list of the plugin's RPC methods to register: a namespace registers its read-only methods (plugeth: chain information, eth: remote mining work), sensitive methods are listed as namespace_method")
+)
+
+// ParseFlags is invoked by PluGeth with the process arguments. It returns
+// false if the arguments could not be parsed.
+func ParseFlags(args []string) bool {
+	if err := Flags.Parse(args); err != nil {
+		return false
+	}
+	return true
+}
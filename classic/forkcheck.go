@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// forkCheckTimeout bounds the time spent fetching the trusted fork schedule.
+const forkCheckTimeout = 10 * time.Second
+
+// forkSchedule is the trusted fork schedule fetched by --classic.forkcheck. It
+// uses the field names of ChainParameters, so the output of a trusted node's
+// plugeth_chainParameters can serve as the checkpoint.
+type forkSchedule struct {
+	ForkBlocks []uint64 `json:"forkBlocks"`
+	ForkTimes  []uint64 `json:"forkTimes"`
+}
+
+// fetchForkSchedule retrieves the fork schedule served at url.
+func fetchForkSchedule(url string) (*forkSchedule, error) {
+	client := &http.Client{Timeout: forkCheckTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	schedule := new(forkSchedule)
+	if err := json.NewDecoder(resp.Body).Decode(schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// checkForkSchedule compares the fork schedule served at url with the plugin's
+// fork blocks and times, returning an error describing any mismatch.
+func checkForkSchedule(url string) error {
+	schedule, err := fetchForkSchedule(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch fork schedule: %v", err)
+	}
+	if !sameForks(mergeForks(schedule.ForkBlocks), forkBlockIds) {
+		return fmt.Errorf("fork blocks %v do not match the trusted schedule %v", forkBlockIds, schedule.ForkBlocks)
+	}
+	if !sameForks(mergeForks(schedule.ForkTimes), forkTimeIds) {
+		return fmt.Errorf("fork times %v do not match the trusted schedule %v", forkTimeIds, schedule.ForkTimes)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveForkSchedule serves body as the trusted fork schedule.
+func serveForkSchedule(t *testing.T, body string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body == "" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// scheduleJSON renders a fork schedule with the given blocks and times.
+func scheduleJSON(blocks, times []uint64) string {
+	list := func(forks []uint64) string {
+		items := make([]string, len(forks))
+		for i, fork := range forks {
+			items[i] = fmt.Sprint(fork)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	}
+	return fmt.Sprintf(`{"forkBlocks": %s, "forkTimes": %s}`, list(blocks), list(times))
+}
+
+func TestCheckForkSchedule(t *testing.T) {
+	shuffled := append([]uint64{forkBlockIds[len(forkBlockIds)-1]}, forkBlockIds[:len(forkBlockIds)-1]...)
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{"matching", scheduleJSON(forkBlockIds, nil), true},
+		{"unordered with duplicates", scheduleJSON(append(shuffled, forkBlockIds[0]), nil), true},
+		{"missing fork", scheduleJSON(forkBlockIds[:len(forkBlockIds)-1], nil), false},
+		{"extra fork", scheduleJSON(append(append([]uint64{}, forkBlockIds...), 25_000_000), nil), false},
+		{"fork times", scheduleJSON(forkBlockIds, []uint64{1_700_000_000}), false},
+		{"not found", "", false},
+		{"invalid json", `{"forkBlocks": [`, false},
+	}
+	for _, tt := range tests {
+		err := checkForkSchedule(serveForkSchedule(t, tt.body))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error %v, want success %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestForkCheckStartup(t *testing.T) {
+	oldLoader, oldEvents, oldSyncMode := pl, events, syncModeFlag
+	t.Cleanup(func() { pl, events, log, syncModeFlag = oldLoader, oldEvents, testLogger{}, oldSyncMode })
+
+	initialize := func(url string) (panicked bool) {
+		setFlag(t, "classic.forkcheck", url)
+		defer func() { panicked = recover() != nil }()
+		ctx := &testContext{strings: make(map[string]string), bools: make(map[string]bool)}
+		Initialize(ctx, &testLoader{feed: new(testFeed)}, testLogger{})
+		return false
+	}
+	if initialize(serveForkSchedule(t, scheduleJSON(forkBlockIds, nil))) {
+		t.Error("startup refused with a matching fork schedule")
+	}
+	if !initialize(serveForkSchedule(t, scheduleJSON(forkBlockIds[1:], nil))) {
+		t.Error("startup proceeded with a mismatching fork schedule")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+)
+
+var errInvalidForkHash = errors.New("fork hash must be exactly 4 bytes")
+
+// timestampThreshold is the first value of an announced next fork taken as a
+// timestamp rather than a block number, as in go-ethereum's fork ID filter.
+const timestampThreshold = 1438269973
+
+// ForkIDVerdict is the outcome of validating a remote fork ID against the
+// local fork schedule according to the EIP-2124 rules.
+type ForkIDVerdict struct {
+	Accept bool   `json:"accept"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+}
+
+// checksumUpdate calculates the next IEEE CRC32 checksum based on the previous
+// one and a fork block number (equivalent to CRC32(original-blob || fork)).
+func checksumUpdate(hash uint32, fork uint64) uint32 {
+	var blob [8]byte
+	binary.BigEndian.PutUint64(blob[:], fork)
+	return crc32.Update(hash, crc32.IEEETable, blob[:])
+}
+
+// gatherForks returns the block and time based forks in activation order,
+// skipping duplicates and forks enabled at genesis.
+func gatherForks(blocks, times []uint64) []uint64 {
+	var forks []uint64
+	for _, list := range [][]uint64{blocks, times} {
+		for _, fork := range list {
+			if fork == 0 {
+				continue
+			}
+			if len(forks) > 0 && forks[len(forks)-1] == fork {
+				continue
+			}
+			forks = append(forks, fork)
+		}
+	}
+	return forks
+}
+
+// checkForkID validates a remote fork hash and next fork against the local
+// schedule at the given head, following the rules laid out in EIP-2124.
+func checkForkID(genesis [32]byte, blocks, times []uint64, headNumber, headTime uint64, remoteHash [4]byte, remoteNext uint64) *ForkIDVerdict {
+	var (
+		forks      = gatherForks(blocks, times)
+		blockForks = len(gatherForks(blocks, nil))
+		sums       = make([][4]byte, len(forks)+1)
+		hash       = crc32.ChecksumIEEE(genesis[:])
+	)
+	binary.BigEndian.PutUint32(sums[0][:], hash)
+	for i, fork := range forks {
+		hash = checksumUpdate(hash, fork)
+		binary.BigEndian.PutUint32(sums[i+1][:], hash)
+	}
+	// Find the first fork we haven't passed yet, all checksums before it are
+	// part of our past.
+	next := len(forks)
+	for i, fork := range forks {
+		head := headNumber
+		if i >= blockForks {
+			head = headTime
+		}
+		if head < fork {
+			next = i
+			break
+		}
+	}
+	// Rule 1: the checksums match, make sure the remote isn't announcing a
+	// fork we have already passed without it.
+	if sums[next] == remoteHash {
+		head := headNumber
+		if remoteNext > timestampThreshold {
+			head = headTime
+		}
+		if remoteNext > 0 && head >= remoteNext {
+			return &ForkIDVerdict{false, "stale", "remote announces a fork already passed locally"}
+		}
+		return &ForkIDVerdict{true, "match", "remote fork ID matches the local fork ID"}
+	}
+	// Rule 2: the remote checksum is one of our past ones, so the remote is
+	// still syncing. Accept it only if it knows about our next fork.
+	for i := 0; i < next; i++ {
+		if sums[i] == remoteHash {
+			if forks[i] != remoteNext {
+				return &ForkIDVerdict{false, "stale", "remote is syncing and does not know about the next local fork"}
+			}
+			return &ForkIDVerdict{true, "match", "remote is syncing towards the local fork ID"}
+		}
+	}
+	// Rule 3: the remote checksum is one of our future ones, so we are the
+	// ones still syncing.
+	for i := next + 1; i < len(sums); i++ {
+		if sums[i] == remoteHash {
+			return &ForkIDVerdict{true, "future", "remote is ahead of the local head on the same fork schedule"}
+		}
+	}
+	// Rule 4: nothing matched, the remote is on a different chain.
+	return &ForkIDVerdict{false, "incompatible", "remote fork ID is not part of the local fork schedule"}
+}
+
+// CheckPeerForkID reports whether a peer advertising the given fork hash and
+// next fork block would be accepted by this node under the EIP-2124 rules.
+// Checksums start from the genesis the chain config is stored under, so
+// private genesis blocks and --classic.genesis are honoured.
+func (service *ClassicService) CheckPeerForkID(ctx context.Context, forkHash hexutil.Bytes, next uint64) (*ForkIDVerdict, error) {
+	if len(forkHash) != 4 {
+		return nil, errInvalidForkHash
+	}
+	head, err := service.headHeader()
+	if err != nil {
+		return nil, err
+	}
+	var remote [4]byte
+	copy(remote[:], forkHash)
+	genesis := classicGenesisHash
+	if b := backend; b != nil {
+		genesis = configGenesisHash(b)
+	}
+	blocks, times := ForkIDs(nil, nil)
+	return checkForkID(genesis, blocks, times, head.Number.Uint64(), head.Time, remote, next), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"math/big"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+func TestCheckPeerForkID(t *testing.T) {
+	tests := []struct {
+		head   int64
+		hash   string
+		next   uint64
+		accept bool
+		reason string
+	}{
+		// Local and remote at Mystique, both aware of Spiral.
+		{15_000_000, "0x7fd1bb25", 19_250_000, true, "match"},
+		// Local and remote at Spiral, no further fork known.
+		{19_500_000, "0xbe46d57c", 0, true, "match"},
+		// Remote still syncing at Magneto and aware of Mystique.
+		{15_000_000, "0x0f6bf187", 14_525_000, true, "match"},
+		// Remote ahead of the local head on the same schedule.
+		{15_000_000, "0xbe46d57c", 0, true, "future"},
+		// Remote announces Spiral at a block the local head already passed.
+		{19_500_000, "0xbe46d57c", 19_400_000, false, "stale"},
+		// Remote at Magneto that never learned about Mystique.
+		{15_000_000, "0x0f6bf187", 0, false, "stale"},
+		// Ethereum mainnet's London fork ID.
+		{15_000_000, "0xb715077d", 0, false, "incompatible"},
+	}
+	for _, tt := range tests {
+		verdict, err := testService(tt.head).CheckPeerForkID(context.Background(), hexutil.MustDecode(tt.hash), tt.next)
+		if err != nil {
+			t.Fatalf("head %d, fork ID %s/%d: %v", tt.head, tt.hash, tt.next, err)
+		}
+		if verdict.Accept != tt.accept || verdict.Reason != tt.reason {
+			t.Errorf("head %d, fork ID %s/%d: verdict %v/%s, want %v/%s", tt.head, tt.hash, tt.next, verdict.Accept, verdict.Reason, tt.accept, tt.reason)
+		}
+	}
+	if _, err := testService(0).CheckPeerForkID(context.Background(), hexutil.Bytes{1, 2, 3}, 0); err != errInvalidForkHash {
+		t.Errorf("short fork hash: error %v, want %v", err, errInvalidForkHash)
+	}
+}
+
+func TestCheckForkIDTimeBasedNext(t *testing.T) {
+	var (
+		genesis    = [32]byte{1}
+		blocks     = []uint64{100}
+		headNumber = uint64(200)
+		hash       [4]byte
+	)
+	binary.BigEndian.PutUint32(hash[:], checksumUpdate(crc32.ChecksumIEEE(genesis[:]), 100))
+
+	tests := []struct {
+		headTime uint64
+		next     uint64
+		accept   bool
+		reason   string
+	}{
+		// The announced fork is a timestamp still ahead of the local head
+		{1_700_000_000, 1_800_000_000, true, "match"},
+		// The local head passed the announced timestamp without forking, even
+		// though the head number is far below it
+		{1_800_000_100, 1_800_000_000, false, "stale"},
+		// Block based next forks are still compared with the head number
+		{1_800_000_100, 150, false, "stale"},
+		{1_800_000_100, 300, true, "match"},
+	}
+	for _, tt := range tests {
+		verdict := checkForkID(genesis, blocks, nil, headNumber, tt.headTime, hash, tt.next)
+		if verdict.Accept != tt.accept || verdict.Reason != tt.reason {
+			t.Errorf("head time %d, next %d: verdict %v/%s, want %v/%s", tt.headTime, tt.next, verdict.Accept, verdict.Reason, tt.accept, tt.reason)
+		}
+	}
+}
+
+func TestCheckPeerForkIDGenesis(t *testing.T) {
+	old := backend
+	t.Cleanup(func() { backend = old })
+
+	genesis := &types.Header{Number: new(big.Int), Difficulty: big.NewInt(131072), Extra: []byte("private network")}
+	backend = &testRestrictedBackend{db: &testChainDb{values: make(map[string][]byte)}, genesis: genesis}
+
+	// The fork ID of a private chain at Spiral, with no further fork known
+	genesisHash := genesis.Hash()
+	sum := crc32.ChecksumIEEE(genesisHash[:])
+	for _, fork := range forkBlockIds {
+		sum = checksumUpdate(sum, fork)
+	}
+	private := make([]byte, 4)
+	binary.BigEndian.PutUint32(private, sum)
+
+	service := testService(19_500_000)
+	if verdict, err := service.CheckPeerForkID(context.Background(), private, 0); err != nil || verdict.Reason != "match" {
+		t.Errorf("private genesis fork ID: verdict %+v (error %v), want match", verdict, err)
+	}
+	if verdict, err := service.CheckPeerForkID(context.Background(), hexutil.MustDecode("0xbe46d57c"), 0); err != nil || verdict.Reason != "incompatible" {
+		t.Errorf("mainnet fork ID on a private genesis: verdict %+v (error %v), want incompatible", verdict, err)
+	}
+}
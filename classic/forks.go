@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errUnknownFork = errors.New("unknown fork")
+
+// namedFork is a network upgrade activating at a block number or timestamp.
+type namedFork struct {
+	Name       string
+	Activation uint64
+}
+
+// classicBlockForks lists the block based Ethereum Classic network upgrades
+// in activation order.
+var classicBlockForks = []namedFork{
+	{"Frontier", 0},
+	{"Homestead", 1_150_000},
+	{"Tangerine Whistle", 2_500_000},
+	{"Die Hard", 3_000_000},
+	{"Gotham", 5_000_000},
+	{"Defuse Difficulty Bomb", 5_900_000},
+	{"Atlantis", 8_772_000},
+	{"Agharta", 9_573_000},
+	{"Phoenix", 10_500_839},
+	{"Thanos", 11_700_000},
+	{"Magneto", 13_189_133},
+	{"Mystique", 14_525_000},
+	{"Spiral", 19_250_000},
+}
+
+// classicTimeForks lists the timestamp based network upgrades in activation
+// order. Ethereum Classic has not scheduled any yet.
+var classicTimeForks = []namedFork{}
+
+// activeFork returns the fork of the list with the latest activation at or
+// before the given point, and whether there is one. Of forks sharing an
+// activation the last listed wins.
+func activeFork(forks []namedFork, at uint64) (string, bool) {
+	var (
+		name  string
+		found bool
+		best  uint64
+	)
+	for _, fork := range forks {
+		if fork.Activation <= at && (!found || fork.Activation >= best) {
+			name, found, best = fork.Name, true, fork.Activation
+		}
+	}
+	return name, found
+}
+
+// forkAt returns the name of the fork active at the given block and time.
+// Timestamp based forks take precedence over block based ones, as they are
+// always scheduled after them.
+func forkAt(number, time uint64) string {
+	if name, ok := activeFork(classicTimeForks, time); ok {
+		return name
+	}
+	name, _ := activeFork(classicBlockForks, number)
+	return name
+}
+
+// WhichForkByTime returns the name of the fork active at the given timestamp.
+// Block based forks are resolved against the current head, so timestamps in
+// the past report the fork of the head rather than the one active back then.
+func (service *ClassicService) WhichForkByTime(ctx context.Context, timestamp uint64) (string, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return "", err
+	}
+	return forkAt(head.Number.Uint64(), timestamp), nil
+}
+
+// forkPredicates maps the plugin's fork predicates to the fork enabling them.
+var forkPredicates = []struct {
+	name string
+	fork string
+}{
+	{"Is160", "Die Hard"},
+	{"IsMystique", "Mystique"},
+	{"IsShanghai", "Spiral"},
+}
+
+// forkActivation returns the activation of the named fork, matched case
+// insensitively.
+func forkActivation(forks []namedFork, name string) (int, bool) {
+	for i, fork := range forks {
+		if strings.EqualFold(fork.Name, name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// PredicateChange compares a fork predicate under the current and the
+// simulated schedule.
+type PredicateChange struct {
+	Name      string `json:"name"`
+	Current   bool   `json:"current"`
+	Simulated bool   `json:"simulated"`
+	Changed   bool   `json:"changed"`
+}
+
+// ForkSimResult is the outcome of simulating a moved fork block.
+// DisabledOpcodes are the opcodes disabled at Height under the simulated
+// schedule.
+type ForkSimResult struct {
+	Fork            string             `json:"fork"`
+	Block           uint64             `json:"block"`
+	Height          uint64             `json:"height"`
+	CurrentFork     string             `json:"currentFork"`
+	SimulatedFork   string             `json:"simulatedFork"`
+	Predicates      []*PredicateChange `json:"predicates"`
+	DisabledOpcodes []int              `json:"disabledOpcodes"`
+}
+
+// simulateForkChange evaluates the fork predicates at height for the current
+// schedule and for one where the named fork activates at block instead.
+func simulateForkChange(forks []namedFork, forkName string, block, height uint64) (*ForkSimResult, error) {
+	index, ok := forkActivation(forks, forkName)
+	if !ok {
+		return nil, errUnknownFork
+	}
+	simulated := append([]namedFork{}, forks...)
+	simulated[index].Activation = block
+
+	current, _ := activeFork(forks, height)
+	moved, _ := activeFork(simulated, height)
+	result := &ForkSimResult{
+		Fork:            forks[index].Name,
+		Block:           block,
+		Height:          height,
+		CurrentFork:     current,
+		SimulatedFork:   moved,
+		DisabledOpcodes: disabledOpcodes(simulated, height),
+	}
+	for _, predicate := range forkPredicates {
+		i, _ := forkActivation(forks, predicate.fork)
+		change := &PredicateChange{
+			Name:      predicate.name,
+			Current:   forks[i].Activation <= height,
+			Simulated: simulated[i].Activation <= height,
+		}
+		change.Changed = change.Current != change.Simulated
+		result.Predicates = append(result.Predicates, change)
+	}
+	return result, nil
+}
+
+// disabledOpcodes returns the opcodes disabled at height under the given
+// schedule, mirroring OpCodeSelectAt.
+func disabledOpcodes(forks []namedFork, height uint64) []int {
+	codes := OpCodeSelect()
+	if spiral, ok := forkActivation(forks, "Spiral"); ok && forks[spiral].Activation > height {
+		codes = append(codes, 0x5f)
+	}
+	return codes
+}
+
+// SimulateForkChange reports which fork predicates would hold at atHeight if
+// the named fork activated at newBlock instead of its scheduled block. The
+// plugin's schedule is not modified.
+func (service *ClassicService) SimulateForkChange(ctx context.Context, forkName string, newBlock uint64, atHeight uint64) (*ForkSimResult, error) {
+	return simulateForkChange(classicBlockForks, forkName, newBlock, atHeight)
+}
+
+// ForkInfo describes the activation state of a fork at the current head.
+type ForkInfo struct {
+	Name            string `json:"name"`
+	Block           uint64 `json:"block"`
+	Active          bool   `json:"active"`
+	BlocksRemaining uint64 `json:"blocksRemaining"`
+}
+
+// ForkStatusResult lists the Ethereum Classic forks at the current head.
+type ForkStatusResult struct {
+	Head  uint64      `json:"head"`
+	Forks []*ForkInfo `json:"forks"`
+}
+
+// forkStatus evaluates the block based forks at the given head.
+func forkStatus(head uint64) *ForkStatusResult {
+	result := &ForkStatusResult{Head: head}
+	for _, fork := range classicBlockForks {
+		if fork.Activation == 0 {
+			continue
+		}
+		info := &ForkInfo{Name: fork.Name, Block: fork.Activation, Active: head >= fork.Activation}
+		if !info.Active {
+			info.BlocksRemaining = fork.Activation - head
+		}
+		result.Forks = append(result.Forks, info)
+	}
+	return result
+}
+
+// ForkStatus lists each Ethereum Classic fork with its activation block,
+// whether it is active at the current head and, for pending forks, the number
+// of blocks until it activates.
+func (service *ClassicService) ForkStatus(ctx context.Context) (*ForkStatusResult, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return nil, err
+	}
+	return forkStatus(head.Number.Uint64()), nil
+}
+
+// IsSyncedToFork reports whether the current head has reached the activation
+// block of the named fork.
+func (service *ClassicService) IsSyncedToFork(ctx context.Context, fork string) (bool, error) {
+	index, ok := forkActivation(classicBlockForks, fork)
+	if !ok {
+		return false, fmt.Errorf("%w %q", errUnknownFork, fork)
+	}
+	head, err := service.headHeader()
+	if err != nil {
+		return false, err
+	}
+	return head.Number.Uint64() >= classicBlockForks[index].Activation, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulateForkChange(t *testing.T) {
+	tests := []struct {
+		fork      string
+		block     uint64
+		height    uint64
+		current   string
+		simulated string
+		opcodes   []int
+	}{
+		{"Spiral", 19_250_000, 19_250_000, "Spiral", "Spiral", OpCodeSelectAt(big.NewInt(19_250_000))},
+		{"Spiral", 20_000_000, 19_500_000, "Spiral", "Mystique", []int{0x48, 0x5f}},
+		{"spiral", 19_000_000, 19_100_000, "Mystique", "Spiral", []int{0x48}},
+		{"Mystique", 14_000_000, 14_200_000, "Magneto", "Mystique", OpCodeSelectAt(big.NewInt(14_200_000))},
+	}
+	for _, tt := range tests {
+		result, err := simulateForkChange(classicBlockForks, tt.fork, tt.block, tt.height)
+		if err != nil {
+			t.Fatalf("%s at %d: %v", tt.fork, tt.block, err)
+		}
+		if result.CurrentFork != tt.current || result.SimulatedFork != tt.simulated {
+			t.Errorf("%s at %d, height %d: forks %s -> %s, want %s -> %s", tt.fork, tt.block, tt.height, result.CurrentFork, result.SimulatedFork, tt.current, tt.simulated)
+		}
+		if !reflect.DeepEqual(result.DisabledOpcodes, tt.opcodes) {
+			t.Errorf("%s at %d, height %d: disabled opcodes %v, want %v", tt.fork, tt.block, tt.height, result.DisabledOpcodes, tt.opcodes)
+		}
+	}
+	if _, err := simulateForkChange(classicBlockForks, "London", 1, 1); err != errUnknownFork {
+		t.Errorf("unknown fork: error %v, want %v", err, errUnknownFork)
+	}
+}
+
+func TestSimulateForkChangePredicates(t *testing.T) {
+	result, err := simulateForkChange(classicBlockForks, "Spiral", 20_000_000, 19_500_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range result.Predicates {
+		want := change.Name == "IsShanghai"
+		if change.Changed != want {
+			t.Errorf("%s: changed %v, want %v", change.Name, change.Changed, want)
+		}
+	}
+}
+
+func TestWhichForkByTime(t *testing.T) {
+	now := uint64(time.Now().Unix())
+	tests := []struct {
+		head int64
+		want string
+	}{
+		{19_250_000, "Spiral"},
+		{19_249_999, "Mystique"},
+		{13_189_133, "Magneto"},
+		{0, "Frontier"},
+	}
+	for _, tt := range tests {
+		fork, err := testService(tt.head).WhichForkByTime(context.Background(), now)
+		if err != nil {
+			t.Fatalf("head %d: %v", tt.head, err)
+		}
+		if fork != tt.want {
+			t.Errorf("head %d: fork %q at the present time, want %q", tt.head, fork, tt.want)
+		}
+	}
+
+	// Scheduled timestamp forks take over once active
+	old := classicTimeForks
+	classicTimeForks = []namedFork{{"Future", now + 3600}}
+	t.Cleanup(func() { classicTimeForks = old })
+
+	service := testService(19_250_000)
+	if fork, _ := service.WhichForkByTime(context.Background(), now); fork != "Spiral" {
+		t.Errorf("before the time fork: fork %q, want Spiral", fork)
+	}
+	if fork, _ := service.WhichForkByTime(context.Background(), now+3600); fork != "Future" {
+		t.Errorf("at the time fork: fork %q, want Future", fork)
+	}
+}
+
+func TestForkStatus(t *testing.T) {
+	status, err := testService(14_000_000).ForkStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Head != 14_000_000 {
+		t.Errorf("head %d, want 14000000", status.Head)
+	}
+	forks := make(map[string]*ForkInfo)
+	for _, fork := range status.Forks {
+		forks[fork.Name] = fork
+	}
+	if len(forks) != len(classicBlockForks)-1 {
+		t.Errorf("listed %d forks, want every fork after Frontier", len(forks))
+	}
+	tests := []ForkInfo{
+		{Name: "Homestead", Block: 1_150_000, Active: true},
+		{Name: "Atlantis", Block: 8_772_000, Active: true},
+		{Name: "Agharta", Block: 9_573_000, Active: true},
+		{Name: "Phoenix", Block: 10_500_839, Active: true},
+		{Name: "Magneto", Block: 13_189_133, Active: true},
+		{Name: "Mystique", Block: 14_525_000, BlocksRemaining: 525_000},
+		{Name: "Spiral", Block: 19_250_000, BlocksRemaining: 5_250_000},
+	}
+	for _, want := range tests {
+		if fork := forks[want.Name]; fork == nil || *fork != want {
+			t.Errorf("fork %s: %+v, want %+v", want.Name, fork, want)
+		}
+	}
+}
+
+func TestIsSyncedToFork(t *testing.T) {
+	const magneto = 13_189_133
+	tests := []struct {
+		head   int64
+		synced bool
+	}{
+		{magneto - 1, false},
+		{magneto, true},
+		{magneto + 1, true},
+	}
+	for _, tt := range tests {
+		synced, err := testService(tt.head).IsSyncedToFork(context.Background(), "Magneto")
+		if err != nil {
+			t.Fatalf("head %d: %v", tt.head, err)
+		}
+		if synced != tt.synced {
+			t.Errorf("head %d: synced to Magneto %v, want %v", tt.head, synced, tt.synced)
+		}
+	}
+	if _, err := testService(magneto).IsSyncedToFork(context.Background(), "Byzantium"); !errors.Is(err, errUnknownFork) {
+		t.Errorf("unknown fork: error %v, want %v", err, errUnknownFork)
+	}
+}
+
+func TestIsMystique(t *testing.T) {
+	const mystique = 14_525_000
+	tests := []struct {
+		number   int64
+		mystique bool
+	}{
+		{mystique - 1, false},
+		{mystique, true},
+		{mystique + 1, true},
+	}
+	for _, tt := range tests {
+		number := big.NewInt(tt.number)
+		if IsMystique(number) != tt.mystique {
+			t.Errorf("block %d: Mystique %v, want %v", tt.number, !tt.mystique, tt.mystique)
+		}
+		// Classic never adopted the EIP-1559 fee market, before or after Mystique
+		if Is1559(number) {
+			t.Errorf("block %d: EIP-1559 active", tt.number)
+		}
+	}
+}
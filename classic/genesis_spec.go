@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted/crypto"
+	trie "github.com/openrelayxyz/plugeth-utils/restricted/hasher"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// genesisFile holds the fields of a genesis JSON document that make up the
+// genesis block.
+type genesisFile struct {
+	Nonce      hexutil.Uint64 `json:"nonce"`
+	Timestamp  hexutil.Uint64 `json:"timestamp"`
+	ExtraData  hexutil.Bytes  `json:"extraData"`
+	GasLimit   hexutil.Uint64 `json:"gasLimit"`
+	Difficulty *hexutil.Big   `json:"difficulty"`
+	MixHash    core.Hash      `json:"mixHash"`
+	Coinbase   core.Address   `json:"coinbase"`
+	Alloc      map[string]struct {
+		Balance *hexutil.Big `json:"balance"`
+	} `json:"alloc"`
+}
+
+// stateRoot returns the root of the state trie holding the genesis alloc.
+// Only balances are considered, the Classic genesis allocates no code or
+// storage.
+func (g *genesisFile) stateRoot() (core.Hash, error) {
+	type leaf struct{ key, value []byte }
+	leaves := make([]leaf, 0, len(g.Alloc))
+	for addr, account := range g.Alloc {
+		raw, err := hexutil.Decode("0x" + addr)
+		if err != nil || len(raw) != len(core.Address{}) {
+			return core.Hash{}, fmt.Errorf("invalid alloc address %q", addr)
+		}
+		balance := new(big.Int)
+		if account.Balance != nil {
+			balance = account.Balance.ToInt()
+		}
+		value, err := rlp.EncodeToBytes(&core.StateAccount{
+			Balance:  balance,
+			Root:     types.EmptyRootHash,
+			CodeHash: crypto.Keccak256(nil),
+		})
+		if err != nil {
+			return core.Hash{}, err
+		}
+		leaves = append(leaves, leaf{crypto.Keccak256(raw), value})
+	}
+	// The stack trie requires its keys in ascending order
+	sort.Slice(leaves, func(i, j int) bool { return bytes.Compare(leaves[i].key, leaves[j].key) < 0 })
+	st := trie.NewStackTrie(nil)
+	for _, l := range leaves {
+		if err := st.TryUpdate(l.key, l.value); err != nil {
+			return core.Hash{}, err
+		}
+	}
+	return st.Hash(), nil
+}
+
+// header assembles the genesis block header.
+func (g *genesisFile) header() (*types.Header, error) {
+	root, err := g.stateRoot()
+	if err != nil {
+		return nil, err
+	}
+	difficulty := new(big.Int)
+	if g.Difficulty != nil {
+		difficulty = g.Difficulty.ToInt()
+	}
+	return &types.Header{
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    g.Coinbase,
+		Root:        root,
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		Difficulty:  difficulty,
+		Number:      new(big.Int),
+		GasLimit:    uint64(g.GasLimit),
+		Time:        uint64(g.Timestamp),
+		Extra:       g.ExtraData,
+		MixDigest:   g.MixHash,
+		Nonce:       types.EncodeNonce(uint64(g.Nonce)),
+	}, nil
+}
+
+// GenesisSpec returns the Ethereum Classic genesis JSON, including the
+// mainnet alloc, for use with plugeth init. The genesis block described by
+// the document is hashed and checked against the Classic genesis hash, so a
+// drifting spec is reported instead of initializing a foreign chain.
+func GenesisSpec() ([]byte, error) {
+	spec := GenesisBlock()
+	var genesis genesisFile
+	if err := json.Unmarshal(spec, &genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis spec: %w", err)
+	}
+	header, err := genesis.header()
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis spec: %w", err)
+	}
+	if hash := header.Hash(); hash != classicGenesisHash {
+		return nil, fmt.Errorf("genesis spec hash mismatch: have %x, want %x", hash, classicGenesisHash)
+	}
+	return spec, nil
+}
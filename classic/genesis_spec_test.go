@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestGenesisSpec(t *testing.T) {
+	spec, err := GenesisSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(spec, GenesisBlock()) {
+		t.Error("genesis spec differs from the embedded genesis block")
+	}
+	var genesis genesisFile
+	if err := json.Unmarshal(spec, &genesis); err != nil {
+		t.Fatal(err)
+	}
+	if len(genesis.Alloc) == 0 {
+		t.Error("genesis spec without the mainnet alloc")
+	}
+
+	// Any change to the spec drifts the genesis hash
+	header, err := genesis.header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Hash() != classicGenesisHash {
+		t.Errorf("genesis hash %x, want %x", header.Hash(), classicGenesisHash)
+	}
+	genesis.Nonce++
+	if header, _ := genesis.header(); header.Hash() == classicGenesisHash {
+		t.Error("altered genesis spec still hashes to the Classic genesis")
+	}
+}
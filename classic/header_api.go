@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+var errParentMismatch = errors.New("parent hash does not match the parent header")
+
+// HeaderCheck is the outcome of a single header validity check.
+type HeaderCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HeaderVerdict is the outcome of every consensus check run on a header.
+type HeaderVerdict struct {
+	Valid  bool           `json:"valid"`
+	Checks []*HeaderCheck `json:"checks"`
+}
+
+// add records the outcome of a check.
+func (v *HeaderVerdict) add(name string, err error) {
+	check := &HeaderCheck{Name: name, Passed: err == nil}
+	if err != nil {
+		check.Error = err.Error()
+		v.Valid = false
+	}
+	v.Checks = append(v.Checks, check)
+}
+
+// verifyHeaderFull runs the consensus header checks against the parent. The
+// proof-of-work is only verified if an engine is given, and only for headers
+// below epochLimit, as returned by epochLimit.
+func verifyHeaderFull(config *PluginConfigurator, ethash *Ethash, header, parent *types.Header, epochLimit uint64) *HeaderVerdict {
+	verdict := &HeaderVerdict{Valid: true}
+
+	var err error
+	if uint64(len(header.Extra)) > MaximumExtraDataSize {
+		err = fmt.Errorf("extra-data too long: %d > %d", len(header.Extra), MaximumExtraDataSize)
+	}
+	verdict.add("extraData", err)
+
+	err = nil
+	if header.ParentHash != parent.Hash() {
+		err = errParentMismatch
+	}
+	verdict.add("parent", err)
+
+	err = nil
+	if diff := new(big.Int).Sub(header.Number, parent.Number); diff.Cmp(big1) != 0 {
+		err = ErrInvalidNumber
+	}
+	verdict.add("number", err)
+
+	verdict.add("timestamp", VerifyTimestamp(parent, header))
+
+	err = nil
+	if expected := CalcDifficulty(config, header.Time, parent); expected.Cmp(header.Difficulty) != 0 {
+		err = fmt.Errorf("invalid difficulty: have %v, want %v", header.Difficulty, expected)
+	}
+	verdict.add("difficulty", err)
+
+	err = nil
+	if header.GasLimit > MaxGasLimit {
+		err = fmt.Errorf("invalid gasLimit: have %v, max %v", header.GasLimit, MaxGasLimit)
+	} else if header.GasUsed > header.GasLimit {
+		err = fmt.Errorf("invalid gasUsed: have %d, gasLimit %d", header.GasUsed, header.GasLimit)
+	}
+	verdict.add("gas", err)
+
+	verdict.add("daoExtraData", VerifyDAOHeaderExtraData(*config, header))
+
+	if ethash == nil {
+		verdict.add("pow", errEngineNotReady)
+	} else if err := checkEpoch(header.Number.Uint64(), epochLimit, ethash.config.ECIP1099Block); err != nil {
+		verdict.add("pow", err)
+	} else {
+		cache := ethash.cache(header.Number.Uint64())
+		verdict.add("pow", ethash.verifySealLight(header, cache))
+		cache.unref()
+	}
+	return verdict
+}
+
+// VerifyHeaderFull runs every consensus header check (extra-data, parent
+// linkage, number, timestamp, difficulty, gas, DAO extra-data and
+// proof-of-work) and reports the outcome of each.
+func (service *ClassicService) VerifyHeaderFull(ctx context.Context, header, parent HeaderSpec) (*HeaderVerdict, error) {
+	h, err := header.toHeader()
+	if err != nil {
+		return nil, err
+	}
+	p, err := parent.toHeader()
+	if err != nil {
+		return nil, err
+	}
+	ethash := eHashForAPI
+
+	var limit uint64
+	if ethash != nil {
+		if limit, err = service.epochLimit(ethash.config.ECIP1099Block); err != nil {
+			return nil, err
+		}
+	}
+	release, err := heavyRPCs.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return verifyHeaderFull(NewPluginConfig(), ethash, h, p, limit), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// testHeaderPair returns a parent header and a child header satisfying every
+// consensus rule, sealed for a test mode ethash engine.
+func testHeaderPair() (parent, header *types.Header) {
+	parent = &types.Header{
+		UncleHash:  types.EmptyUncleHash,
+		Number:     big.NewInt(99),
+		Difficulty: big.NewInt(131072),
+		GasLimit:   5000,
+		Time:       1000,
+	}
+	header = &types.Header{
+		ParentHash: parent.Hash(),
+		UncleHash:  types.EmptyUncleHash,
+		Number:     big.NewInt(100),
+		GasLimit:   5000,
+		Time:       1010,
+		MixDigest:  core.HexToHash("0x2545fb7eacd345791c33bc37cb93b0198da3356a2d2b6e8320f9f027f1c08ae3"),
+		Nonce:      types.EncodeNonce(187821),
+	}
+	header.Difficulty = CalcDifficulty(NewPluginConfig(), header.Time, parent)
+	return parent, header
+}
+
+// failedChecks returns the names of the checks of the verdict that failed.
+func failedChecks(verdict *HeaderVerdict) []string {
+	var failed []string
+	for _, check := range verdict.Checks {
+		if !check.Passed {
+			failed = append(failed, check.Name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+func TestVerifyHeaderFull(t *testing.T) {
+	ethash := newTestEthash(t)
+
+	daoConfig := *NewPluginConfig()
+	daoConfig.DAOForkBlock = big.NewInt(100)
+
+	tests := []struct {
+		name   string
+		config *PluginConfigurator
+		mutate func(parent, header *types.Header)
+		failed []string // Altering the header always breaks its seal as well
+	}{
+		{"valid", nil, func(parent, header *types.Header) {}, nil},
+		{"extraData", nil, func(parent, header *types.Header) { header.Extra = make([]byte, MaximumExtraDataSize+1) }, []string{"extraData", "pow"}},
+		{"parent", nil, func(parent, header *types.Header) { header.ParentHash = core.Hash{1} }, []string{"parent", "pow"}},
+		{"number", nil, func(parent, header *types.Header) { header.Number = big.NewInt(101) }, []string{"number", "pow"}},
+		{"timestamp", nil, func(parent, header *types.Header) { parent.Time = header.Time }, []string{"parent", "timestamp"}},
+		{"difficulty", nil, func(parent, header *types.Header) { header.Difficulty = new(big.Int).Add(header.Difficulty, big1) }, []string{"difficulty", "pow"}},
+		{"gas", nil, func(parent, header *types.Header) { header.GasUsed = header.GasLimit + 1 }, []string{"gas", "pow"}},
+		{"daoExtraData", &daoConfig, func(parent, header *types.Header) {}, []string{"daoExtraData"}},
+		{"pow", nil, func(parent, header *types.Header) { header.Nonce = types.EncodeNonce(0) }, []string{"pow"}},
+	}
+	for _, tt := range tests {
+		parent, header := testHeaderPair()
+		tt.mutate(parent, header)
+		config := tt.config
+		if config == nil {
+			config = NewPluginConfig()
+		}
+		verdict := verifyHeaderFull(config, ethash, header, parent, header.Number.Uint64()+1)
+		if failed := failedChecks(verdict); strings.Join(failed, ",") != strings.Join(tt.failed, ",") {
+			t.Errorf("%s: failed checks %v, want %v", tt.name, failed, tt.failed)
+		}
+		if verdict.Valid != (len(tt.failed) == 0) {
+			t.Errorf("%s: valid %v, want %v", tt.name, verdict.Valid, len(tt.failed) == 0)
+		}
+	}
+}
+
+func TestVerifyHeaderFullEpochBound(t *testing.T) {
+	ethash := newTestEthash(t)
+	parent, header := testHeaderPair()
+
+	verdict := verifyHeaderFull(NewPluginConfig(), ethash, header, parent, header.Number.Uint64())
+	for _, check := range verdict.Checks {
+		if check.Name == "pow" && (check.Passed || !strings.Contains(check.Error, errEpochOutOfRange.Error())) {
+			t.Errorf("pow check %+v, want %v", check, errEpochOutOfRange)
+		}
+	}
+	if key := epochLengthDefault + calcEpoch(header.Number.Uint64(), epochLengthDefault); ethash.caches.cache.Contains(key) {
+		t.Error("cache generated for a header beyond the epoch limit")
+	}
+}
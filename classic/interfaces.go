@@ -10,6 +10,12 @@ import (
 
 type cacheOrDataset interface {
 	*cache | *dataset
+	generated() bool
+	ref()
+	unref()
+	release()
+	restore()
+	size() uint64
 }
 
 type ChainHeaderReader interface {
@@ -329,6 +335,8 @@ type EthashConfigurator interface {
 	SetEthashECIP1017Transition(n *uint64) error
 	GetEthashECIP1017EraRounds() *uint64
 	SetEthashECIP1017EraRounds(n *uint64) error
+	GetEthashECIP1017EraRoundsSchedule() Uint64BigMapEncodesHex
+	SetEthashECIP1017EraRoundsSchedule(m Uint64BigMapEncodesHex) error
 	GetEthashEIP100BTransition() *uint64
 	SetEthashEIP100BTransition(n *uint64) error
 	GetEthashECIP1041Transition() *uint64
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobInfo describes a background job in flight.
+type JobInfo struct {
+	ID       uint64    `json:"id"`
+	Type     string    `json:"type"`
+	Epoch    uint64    `json:"epoch"`
+	Started  time.Time `json:"started"`
+	Progress float64   `json:"progress"`
+}
+
+// job is a background job registered with the job registry.
+type job struct {
+	info     JobInfo
+	progress func() float64 // Percentage completed, nil if unknown
+}
+
+// jobRegistry tracks the background jobs of the plugin, such as ethash cache
+// and dataset generations.
+type jobRegistry struct {
+	mu   sync.Mutex
+	next uint64
+	jobs map[uint64]*job
+}
+
+var jobs = &jobRegistry{jobs: make(map[uint64]*job)}
+
+// start registers a new job and returns the function to call once it is done.
+func (r *jobRegistry) start(kind string, epoch uint64, progress func() float64) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.next++
+	id := r.next
+	r.jobs[id] = &job{
+		info:     JobInfo{ID: id, Type: kind, Epoch: epoch, Started: time.Now()},
+		progress: progress,
+	}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.jobs, id)
+	}
+}
+
+// list returns the jobs in flight, oldest first.
+func (r *jobRegistry) list() []JobInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	infos := make([]JobInfo, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		info := j.info
+		if j.progress != nil {
+			info.Progress = j.progress()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, k int) bool { return infos[i].ID < infos[k].ID })
+	return infos
+}
+
+// BackgroundJobs lists the background jobs currently in flight with their
+// type, start time and progress.
+func (service *ClassicService) BackgroundJobs(ctx context.Context) ([]JobInfo, error) {
+	return jobs.list(), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBackgroundJobs(t *testing.T) {
+	old := jobs
+	jobs = &jobRegistry{jobs: make(map[uint64]*job)}
+	t.Cleanup(func() { jobs = old })
+	service := new(ClassicService)
+
+	progress := 10.0
+	doneFirst := jobs.start("warmup", 3, func() float64 { return progress })
+	doneSecond := jobs.start("health", 0, nil)
+
+	list, err := service.BackgroundJobs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("listed %d jobs, want 2", len(list))
+	}
+	if first := list[0]; first.Type != "warmup" || first.Epoch != 3 || first.Progress != 10 || first.Started.IsZero() {
+		t.Errorf("first job %+v, want warmup of epoch 3 at 10%%", first)
+	}
+	if second := list[1]; second.Type != "health" || second.Progress != 0 {
+		t.Errorf("second job %+v, want health without progress", second)
+	}
+
+	// Progress is read when listing, finished jobs disappear
+	progress = 60
+	doneSecond()
+	list, _ = service.BackgroundJobs(context.Background())
+	if len(list) != 1 || list[0].Type != "warmup" || list[0].Progress != 60 {
+		t.Errorf("jobs %+v, want only warmup at 60%%", list)
+	}
+	doneFirst()
+	if list, _ := service.BackgroundJobs(context.Background()); len(list) != 0 {
+		t.Errorf("jobs %+v after all finished, want none", list)
+	}
+}
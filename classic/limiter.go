@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+var errServerBusy = errors.New("server busy, too many concurrent requests")
+
+// heavyRPCLimiter bounds the number of expensive RPC calls, such as PoW
+// verification and state replays, executing at the same time.
+type heavyRPCLimiter struct {
+	once sync.Once
+	sem  chan struct{}
+}
+
+var heavyRPCs = &heavyRPCLimiter{}
+
+// acquire reserves a slot for a heavy RPC call, failing immediately with
+// errServerBusy if --classic.maxconcurrentrpc calls are already running. The
+// returned function must be called to release the slot.
+func (l *heavyRPCLimiter) acquire() (func(), error) {
+	l.once.Do(func() {
+		if *maxConcurrentRPC > 0 {
+			l.sem = make(chan struct{}, *maxConcurrentRPC)
+		}
+	})
+	if l.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return func() { <-l.sem }, nil
+	default:
+		return nil, errServerBusy
+	}
+}
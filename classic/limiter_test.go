@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+)
+
+func TestHeavyRPCLimit(t *testing.T) {
+	setFlag(t, "classic.maxconcurrentrpc", "2")
+	old := heavyRPCs
+	heavyRPCs = &heavyRPCLimiter{}
+	t.Cleanup(func() { heavyRPCs = old })
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		releases []func()
+		rejected int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := heavyRPCs.acquire()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == errServerBusy {
+				rejected++
+				return
+			}
+			releases = append(releases, release)
+		}()
+	}
+	wg.Wait()
+	if len(releases) != 2 || rejected != 3 {
+		t.Fatalf("%d calls admitted and %d rejected, want 2 and 3", len(releases), rejected)
+	}
+
+	// Heavy RPCs are turned away while the slots are taken, light ones are not
+	service := testService(100)
+	if _, err := service.ReplayRewards(context.Background(), restricted.LatestBlockNumber); err != errServerBusy {
+		t.Errorf("heavy RPC at the limit: error %v, want %v", err, errServerBusy)
+	}
+	if _, err := service.EraForBlock(context.Background(), restricted.LatestBlockNumber); err != nil {
+		t.Errorf("light RPC at the limit: %v", err)
+	}
+
+	for _, release := range releases {
+		release()
+	}
+	release, err := heavyRPCs.acquire()
+	if err != nil {
+		t.Fatalf("call after releasing the slots: %v", err)
+	}
+	release()
+}
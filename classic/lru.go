@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -14,10 +15,16 @@ type lru[T cacheOrDataset] struct {
 	new  func(epoch uint64, epochLength uint64) T
 	mu   sync.Mutex
 	// Items are kept in a LRU cache, but there is a special case:
-	// We always keep an item for (highest seen epoch) + 1 as the 'future item'.
-	cache      BasicLRU[uint64, T]
-	future     uint64
-	futureItem T
+	// We always keep items for the epochs following the highest seen epoch
+	// as the 'future items'. Their number is set by the look-ahead window.
+	cache       evictionPolicy[uint64, T]
+	lookahead   int
+	futureItems map[uint64]T
+
+	// inflight holds the items handed out that have not finished generating,
+	// so an item evicted or dropped from the look-ahead window while still
+	// being generated is reused instead of generated a second time.
+	inflight map[uint64]T
 }
 
 // cache wraps an ethash cache with some metadata to allow easier concurrent use.
@@ -27,7 +34,11 @@ type cache struct {
 	dump        *os.File  // File descriptor of the memory mapped cache
 	mmap        mmap.MMap // Memory map itself to unmap before releasing
 	cache       []uint32  // The actual cache data content (may be memory mapped)
-	once        sync.Once // Ensures the cache is generated only once
+	once        sync.Once   // Ensures the cache is generated only once
+	done        atomic.Bool // Atomic flag to determine generation status
+	refs        sync.Mutex  // Guards users and evicted
+	users       int         // Number of callers (and generators) using the cache
+	evicted     bool        // Whether the cache was dropped by its lru
 }
 
 // dataset wraps an ethash dataset with some metadata to allow easier concurrent use.
@@ -39,11 +50,34 @@ type dataset struct {
 	dataset     []uint32    // The actual cache data content
 	once        sync.Once   // Ensures the cache is generated only once
 	done        atomic.Bool // Atomic flag to determine generation status
-}
+	refs        sync.Mutex  // Guards users and evicted
+	users       int         // Number of callers (and generators) using the dataset
+	evicted     bool        // Whether the dataset was dropped by its lru
+}
+
+// evictionPolicy is the subset of cache operations the lru wrapper relies on,
+// allowing the eviction strategy for caches and datasets to be swapped.
+type evictionPolicy[K comparable, V any] interface {
+	Add(key K, value V) (evicted bool)
+	Contains(key K) bool
+	Get(key K) (value V, ok bool)
+	Values() []V
+	Purge()
+}
+
+// Supported eviction policies for ethash caches and datasets.
+const (
+	evictLRU  = "lru"  // Evict the least recently used epoch
+	evictLFU  = "lfu"  // Evict the least frequently used epoch
+	evictSize = "size" // Evict the least recently used epochs beyond a memory budget
+)
 
 // newlru create a new least-recently-used cache for either the verification caches
-// or the mining datasets.
-func newlru[T cacheOrDataset](maxItems int, new func(epoch uint64, epochLength uint64) T) *lru[T] {
+// or the mining datasets, pre-provisioning lookahead epochs ahead of the most
+// recently requested one. If policy is evictLFU, items are instead evicted by
+// access frequency, if it is evictSize, the least recently used items are
+// evicted once their total size exceeds budget bytes.
+func newlru[T cacheOrDataset](maxItems int, lookahead int, policy string, budget uint64, new func(epoch uint64, epochLength uint64) T) *lru[T] {
 	var what string
 	switch any(T(nil)).(type) {
 	case *cache:
@@ -53,17 +87,85 @@ func newlru[T cacheOrDataset](maxItems int, new func(epoch uint64, epochLength u
 	default:
 		panic("unknown type")
 	}
+	if lookahead < 1 {
+		lookahead = 1
+	}
+	// Evicted items are released as soon as their last user is done with them,
+	// rather than holding on to their memory maps until garbage collected.
+	onEvict := func(_ uint64, item T) { item.release() }
+
+	var cache evictionPolicy[uint64, T]
+	switch policy {
+	case evictLFU:
+		cache = NewBasicLFUWithEvict[uint64, T](maxItems, onEvict)
+	case evictSize:
+		cache = NewSizedLRUWithEvict[uint64, T](budget, func(item T) uint64 { return item.size() }, onEvict)
+	default:
+		basic := NewBasicLRUWithEvict[uint64, T](maxItems, onEvict)
+		cache = &basic
+	}
 	return &lru[T]{
-		what:  what,
-		new:   new,
-		cache: NewBasicLRU[uint64, T](maxItems),
+		what:        what,
+		new:         new,
+		cache:       cache,
+		lookahead:   lookahead,
+		futureItems: make(map[uint64]T),
+		inflight:    make(map[uint64]T),
+	}
+}
+
+// create returns the item for the given epoch that is still being generated,
+// or a new one if there is none. Finished items are dropped from the in-flight
+// set along the way. New items hold a reference on behalf of their generator,
+// dropped once generation is done. It must be called with lru.mu held.
+func (lru *lru[T]) create(key, epoch, epochLength uint64) T {
+	for k, item := range lru.inflight {
+		if item.generated() {
+			delete(lru.inflight, k)
+		}
+	}
+	if item, ok := lru.inflight[key]; ok {
+		item.restore()
+		return item
+	}
+	item := lru.new(epoch, epochLength)
+	item.ref()
+	lru.inflight[key] = item
+	return item
+}
+
+// purge drops all items, releasing each once its last user is done with it.
+func (lru *lru[T]) purge() {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	for _, item := range lru.cache.Values() {
+		item.release()
+	}
+	for _, item := range lru.futureItems {
+		item.release()
+	}
+	lru.cache.Purge()
+	lru.futureItems = make(map[uint64]T)
+}
+
+// snapshot returns the items held by the cache in eviction order, most
+// valuable first, and the items provisioned for future epochs.
+func (lru *lru[T]) snapshot() (items []T, future []T) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	for _, item := range lru.futureItems {
+		future = append(future, item)
 	}
+	return lru.cache.Values(), future
 }
 
 type BasicLRU[K comparable, V any] struct {
-	list  *list[K]
-	items map[K]cacheItem[K, V]
-	cap   int
+	list    *list[K]
+	items   map[K]cacheItem[K, V]
+	cap     int
+	onEvict func(K, V) // Optional callback for items evicted from the cache
 }
 
 type cacheItem[K any, V any] struct {
@@ -84,6 +186,14 @@ func NewBasicLRU[K comparable, V any](capacity int) BasicLRU[K, V] {
 	return c
 }
 
+// NewBasicLRUWithEvict creates a new LRU cache which invokes onEvict for every
+// item dropped from the cache by Add or RemoveOldest.
+func NewBasicLRUWithEvict[K comparable, V any](capacity int, onEvict func(K, V)) BasicLRU[K, V] {
+	c := NewBasicLRU[K, V](capacity)
+	c.onEvict = onEvict
+	return c
+}
+
 // Add adds a value to the cache. Returns true if an item was evicted to store the new item.
 func (c *BasicLRU[K, V]) Add(key K, value V) (evicted bool) {
 	item, ok := c.items[key]
@@ -98,7 +208,11 @@ func (c *BasicLRU[K, V]) Add(key K, value V) (evicted bool) {
 	var elem *listElem[K]
 	if c.Len() >= c.cap {
 		elem = c.list.removeLast()
+		old := c.items[elem.v]
 		delete(c.items, elem.v)
+		if c.onEvict != nil {
+			c.onEvict(elem.v, old.value)
+		}
 		evicted = true
 	} else {
 		elem = new(listElem[K])
@@ -180,15 +294,281 @@ func (c *BasicLRU[K, V]) RemoveOldest() (key K, value V, ok bool) {
 	item := c.items[key]
 	delete(c.items, key)
 	c.list.remove(lastElem)
+	if c.onEvict != nil {
+		c.onEvict(key, item.value)
+	}
 	return key, item.value, true
 }
 
-// Keys returns all keys in the cache.
+// Keys returns all keys in the cache, most recently used first.
 func (c *BasicLRU[K, V]) Keys() []K {
 	keys := make([]K, 0, len(c.items))
 	return c.list.appendTo(keys)
 }
 
+// Values returns all values in the cache, in the same order as Keys.
+func (c *BasicLRU[K, V]) Values() []V {
+	_, values := c.Entries()
+	return values
+}
+
+// Entries returns all keys in the cache and their values, most recently used
+// first.
+func (c *BasicLRU[K, V]) Entries() ([]K, []V) {
+	keys := c.Keys()
+	values := make([]V, len(keys))
+	for i, key := range keys {
+		values[i] = c.items[key].value
+	}
+	return keys, values
+}
+
+// Snapshot returns all keys in the cache, most recently used first.
+func (c *BasicLRU[K, V]) Snapshot() []K {
+	return c.Keys()
+}
+
+// Restore replaces the contents of the cache with the given keys, most recently
+// used first as returned by Snapshot, looking up each value with valueFor.
+// Keys beyond the capacity of the cache are dropped. The items previously held
+// are passed to the eviction callback.
+func (c *BasicLRU[K, V]) Restore(keys []K, valueFor func(K) V) {
+	for c.Len() > 0 {
+		c.RemoveOldest()
+	}
+	if len(keys) > c.cap {
+		keys = keys[:c.cap]
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		c.Add(keys[i], valueFor(keys[i]))
+	}
+}
+
+// BasicLFU is a simple least-frequently-used cache. Items are evicted by the
+// number of times they were accessed, ties going to the least recently used.
+// This type is not safe for concurrent use.
+type BasicLFU[K comparable, V any] struct {
+	items   map[K]*lfuItem[V]
+	tick    uint64
+	cap     int
+	onEvict func(K, V) // Optional callback for items evicted from the cache
+}
+
+type lfuItem[V any] struct {
+	value    V
+	hits     uint64
+	lastUsed uint64
+}
+
+// NewBasicLFU creates a new LFU cache.
+func NewBasicLFU[K comparable, V any](capacity int) *BasicLFU[K, V] {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &BasicLFU[K, V]{
+		items: make(map[K]*lfuItem[V]),
+		cap:   capacity,
+	}
+}
+
+// NewBasicLFUWithEvict creates a new LFU cache which invokes onEvict for every
+// item dropped from the cache by Add.
+func NewBasicLFUWithEvict[K comparable, V any](capacity int, onEvict func(K, V)) *BasicLFU[K, V] {
+	c := NewBasicLFU[K, V](capacity)
+	c.onEvict = onEvict
+	return c
+}
+
+// Add adds a value to the cache. Returns true if an item was evicted to store the new item.
+func (c *BasicLFU[K, V]) Add(key K, value V) (evicted bool) {
+	c.tick++
+	if item, ok := c.items[key]; ok {
+		item.value = value
+		item.hits++
+		item.lastUsed = c.tick
+		return false
+	}
+	if len(c.items) >= c.cap {
+		var (
+			victim K
+			least  *lfuItem[V]
+		)
+		for k, item := range c.items {
+			if least == nil || item.hits < least.hits || (item.hits == least.hits && item.lastUsed < least.lastUsed) {
+				victim, least = k, item
+			}
+		}
+		delete(c.items, victim)
+		if c.onEvict != nil {
+			c.onEvict(victim, least.value)
+		}
+		evicted = true
+	}
+	c.items[key] = &lfuItem[V]{value: value, hits: 1, lastUsed: c.tick}
+	return evicted
+}
+
+// Contains reports whether the given key exists in the cache.
+func (c *BasicLFU[K, V]) Contains(key K) bool {
+	_, ok := c.items[key]
+	return ok
+}
+
+// Get retrieves a value from the cache. This counts as an access of the key.
+func (c *BasicLFU[K, V]) Get(key K) (value V, ok bool) {
+	item, ok := c.items[key]
+	if !ok {
+		return value, false
+	}
+	c.tick++
+	item.hits++
+	item.lastUsed = c.tick
+	return item.value, true
+}
+
+// Len returns the current number of items in the cache.
+func (c *BasicLFU[K, V]) Len() int {
+	return len(c.items)
+}
+
+// Purge empties the cache.
+func (c *BasicLFU[K, V]) Purge() {
+	for k := range c.items {
+		delete(c.items, k)
+	}
+}
+
+// Values returns all values in the cache, most frequently used first.
+func (c *BasicLFU[K, V]) Values() []V {
+	items := make([]*lfuItem[V], 0, len(c.items))
+	for _, item := range c.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].hits != items[j].hits {
+			return items[i].hits > items[j].hits
+		}
+		return items[i].lastUsed > items[j].lastUsed
+	})
+	values := make([]V, len(items))
+	for i, item := range items {
+		values[i] = item.value
+	}
+	return values
+}
+
+// SizedLRU is a least-recently-used cache bounded by the total size of its
+// items rather than their number, as reported by a per-item size function.
+// The most recently added item is always kept, even if it alone exceeds the
+// budget. This type is not safe for concurrent use.
+type SizedLRU[K comparable, V any] struct {
+	list    *list[K]
+	items   map[K]sizedItem[K, V]
+	sizeOf  func(V) uint64
+	budget  uint64
+	used    uint64
+	onEvict func(K, V) // Optional callback for items evicted from the cache
+}
+
+type sizedItem[K any, V any] struct {
+	elem  *listElem[K]
+	value V
+	size  uint64
+}
+
+// NewSizedLRU creates a new LRU cache holding items of at most budget total
+// size.
+func NewSizedLRU[K comparable, V any](budget uint64, sizeOf func(V) uint64) *SizedLRU[K, V] {
+	return &SizedLRU[K, V]{
+		list:   newList[K](),
+		items:  make(map[K]sizedItem[K, V]),
+		sizeOf: sizeOf,
+		budget: budget,
+	}
+}
+
+// NewSizedLRUWithEvict creates a new size bounded LRU cache which invokes
+// onEvict for every item dropped from the cache by Add.
+func NewSizedLRUWithEvict[K comparable, V any](budget uint64, sizeOf func(V) uint64, onEvict func(K, V)) *SizedLRU[K, V] {
+	c := NewSizedLRU[K, V](budget, sizeOf)
+	c.onEvict = onEvict
+	return c
+}
+
+// Add adds a value to the cache. Returns true if any items were evicted to
+// stay within the budget.
+func (c *SizedLRU[K, V]) Add(key K, value V) (evicted bool) {
+	size := c.sizeOf(value)
+	if item, ok := c.items[key]; ok {
+		c.used -= item.size
+		item.value, item.size = value, size
+		c.items[key] = item
+		c.list.moveToFront(item.elem)
+	} else {
+		elem := &listElem[K]{v: key}
+		c.items[key] = sizedItem[K, V]{elem, value, size}
+		c.list.pushElem(elem)
+	}
+	c.used += size
+
+	for c.used > c.budget && len(c.items) > 1 {
+		last := c.list.removeLast()
+		item := c.items[last.v]
+		c.used -= item.size
+		delete(c.items, last.v)
+		if c.onEvict != nil {
+			c.onEvict(last.v, item.value)
+		}
+		evicted = true
+	}
+	return evicted
+}
+
+// Contains reports whether the given key exists in the cache.
+func (c *SizedLRU[K, V]) Contains(key K) bool {
+	_, ok := c.items[key]
+	return ok
+}
+
+// Get retrieves a value from the cache. This marks the key as recently used.
+func (c *SizedLRU[K, V]) Get(key K) (value V, ok bool) {
+	item, ok := c.items[key]
+	if !ok {
+		return value, false
+	}
+	c.list.moveToFront(item.elem)
+	return item.value, true
+}
+
+// Len returns the current number of items in the cache.
+func (c *SizedLRU[K, V]) Len() int {
+	return len(c.items)
+}
+
+// Size returns the total size of the items in the cache.
+func (c *SizedLRU[K, V]) Size() uint64 {
+	return c.used
+}
+
+// Purge empties the cache.
+func (c *SizedLRU[K, V]) Purge() {
+	c.list.init()
+	for k := range c.items {
+		delete(c.items, k)
+	}
+	c.used = 0
+}
+
+// Values returns all values in the cache, most recently used first.
+func (c *SizedLRU[K, V]) Values() []V {
+	keys := c.list.appendTo(make([]K, 0, len(c.items)))
+	values := make([]V, len(keys))
+	for i, key := range keys {
+		values[i] = c.items[key].value
+	}
+	return values
+}
+
 // list is a doubly-linked list holding items of type he.
 // The zero value is not valid, use newList to create lists.
 type list[T any] struct {
@@ -253,9 +633,9 @@ func (l *list[T]) last() *listElem[T] {
 	return e
 }
 
-// appendTo appends all list elements to a slice.
+// appendTo appends all list elements to a slice, starting at the front.
 func (l *list[T]) appendTo(slice []T) []T {
-	for e := l.root.prev; e != &l.root; e = e.prev {
+	for e := l.root.next; e != &l.root; e = e.next {
 		slice = append(slice, e.v)
 	}
 	return slice
@@ -264,8 +644,10 @@ func (l *list[T]) appendTo(slice []T) []T {
 // Cache is a LRU cache.
 // This type is safe for concurrent use.
 type Cache[K comparable, V any] struct {
-	cache BasicLRU[K, V]
-	mu    sync.Mutex
+	cache  BasicLRU[K, V]
+	mu     sync.Mutex
+	hits   atomic.Uint64 // Lookups by Get and Peek that found the key
+	misses atomic.Uint64 // Lookups by Get and Peek that did not
 }
 
 // NewCache creates an LRU cache.
@@ -292,9 +674,11 @@ func (c *Cache[K, V]) Contains(key K) bool {
 // Get retrieves a value from the cache. This marks the key as recently used.
 func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	value, ok = c.cache.Get(key)
+	c.mu.Unlock()
 
-	return c.cache.Get(key)
+	c.record(ok)
+	return value, ok
 }
 
 // Len returns the current number of items in the cache.
@@ -308,9 +692,26 @@ func (c *Cache[K, V]) Len() int {
 // Peek retrieves a value from the cache, but does not mark the key as recently used.
 func (c *Cache[K, V]) Peek(key K) (value V, ok bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	value, ok = c.cache.Peek(key)
+	c.mu.Unlock()
+
+	c.record(ok)
+	return value, ok
+}
 
-	return c.cache.Peek(key)
+// record counts a lookup as a hit or a miss.
+func (c *Cache[K, V]) record(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// Stats returns the number of lookups by Get and Peek that found their key and
+// the number that did not.
+func (c *Cache[K, V]) Stats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
 }
 
 // Purge empties the cache.
@@ -329,10 +730,24 @@ func (c *Cache[K, V]) Remove(key K) bool {
 	return c.cache.Remove(key)
 }
 
-// Keys returns all keys of items currently in the LRU.
+// Keys returns all keys of items currently in the LRU, most recently used
+// first.
 func (c *Cache[K, V]) Keys() []K {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	return c.cache.Keys()
-}
\ No newline at end of file
+}
+
+// Trim evicts the least recently used items until at most keep remain and
+// returns the number of items removed.
+func (c *Cache[K, V]) Trim(keep int) (removed int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.cache.Len() > keep {
+		c.cache.RemoveOldest()
+		removed++
+	}
+	return removed
+}
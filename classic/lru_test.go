@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestBasicLRURestore(t *testing.T) {
+	lru := NewBasicLRU[int, string](4)
+	for _, key := range []int{1, 2, 3, 4} {
+		lru.Add(key, "value")
+	}
+	lru.Get(2)
+	snapshot := lru.Snapshot()
+
+	var evicted []int
+	restored := NewBasicLRUWithEvict[int, string](4, func(key int, _ string) { evicted = append(evicted, key) })
+	restored.Add(7, "stale")
+	restored.Add(8, "stale")
+	restored.Restore(snapshot, func(key int) string {
+		value, _ := lru.Peek(key)
+		return value
+	})
+	if !reflect.DeepEqual(restored.Keys(), lru.Keys()) {
+		t.Errorf("restored keys %v, want %v", restored.Keys(), lru.Keys())
+	}
+	sort.Ints(evicted)
+	if !reflect.DeepEqual(evicted, []int{7, 8}) {
+		t.Errorf("evicted %v on restore, want [7 8]", evicted)
+	}
+
+	small := NewBasicLRU[int, string](2)
+	small.Restore(snapshot, func(int) string { return "value" })
+	if want := snapshot[:2]; !reflect.DeepEqual(small.Keys(), want) {
+		t.Errorf("restored keys %v beyond capacity, want %v", small.Keys(), want)
+	}
+}
+
+func TestSizedLRU(t *testing.T) {
+	var evicted []string
+	lru := NewSizedLRUWithEvict[string, int](10, func(size int) uint64 { return uint64(size) }, func(key string, _ int) {
+		evicted = append(evicted, key)
+	})
+	// Many small items fit the budget regardless of their number.
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if lru.Add(key, 2) {
+			t.Fatalf("adding %s evicted within the budget", key)
+		}
+	}
+	lru.Get("a")
+
+	// A single large item evicts as many of the least recently used as needed.
+	if !lru.Add("big", 7) {
+		t.Fatal("adding big did not evict")
+	}
+	if !reflect.DeepEqual(evicted, []string{"b", "c", "d", "e"}) {
+		t.Errorf("evicted %v, want [b c d e]", evicted)
+	}
+	if lru.Len() != 2 || lru.Size() != 9 || !lru.Contains("a") {
+		t.Errorf("holding %d items of size %d, want a and big of size 9", lru.Len(), lru.Size())
+	}
+
+	// An item exceeding the budget on its own is still kept.
+	lru.Add("huge", 20)
+	if lru.Len() != 1 || !lru.Contains("huge") {
+		t.Errorf("holding %d items, want only huge", lru.Len())
+	}
+	lru.Purge()
+	if lru.Len() != 0 || lru.Size() != 0 {
+		t.Errorf("holding %d items of size %d after purge", lru.Len(), lru.Size())
+	}
+}
+
+// cacheEpochs returns the epochs of the given caches in ascending order.
+func cacheEpochs(items []*cache) []uint64 {
+	epochs := make([]uint64, len(items))
+	for i, item := range items {
+		epochs[i] = item.epoch
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+	return epochs
+}
+
+func TestLRULookahead(t *testing.T) {
+	lru := newlru(2, 2, evictLRU, 0, newCache)
+
+	item, future := lru.get(5, epochLengthDefault, nil)
+	item.unref()
+	if epochs := cacheEpochs(future); !reflect.DeepEqual(epochs, []uint64{6, 7}) {
+		t.Errorf("provisioned epochs %v after epoch 5, want [6 7]", epochs)
+	}
+	// Moving on by one epoch only provisions the newly covered one.
+	item, future = lru.get(6, epochLengthDefault, nil)
+	item.unref()
+	if epochs := cacheEpochs(future); !reflect.DeepEqual(epochs, []uint64{8}) {
+		t.Errorf("provisioned epochs %v after epoch 6, want [8]", epochs)
+	}
+	if len(lru.futureItems) != 2 {
+		t.Errorf("holding %d future items, want 2", len(lru.futureItems))
+	}
+}
+
+func TestLFURetainsFrequentEpochs(t *testing.T) {
+	basic := NewBasicLRU[uint64, string](3)
+	policies := map[string]evictionPolicy[uint64, string]{
+		evictLRU: &basic,
+		evictLFU: NewBasicLFU[uint64, string](3),
+	}
+	for name, cache := range policies {
+		// Epoch 1 is verified against repeatedly, then a sweep over other
+		// epochs touches them more recently.
+		cache.Add(1, "dataset")
+		for i := 0; i < 5; i++ {
+			cache.Get(1)
+		}
+		cache.Add(2, "dataset")
+		cache.Add(3, "dataset")
+		cache.Get(2)
+		cache.Get(3)
+		cache.Add(4, "dataset")
+
+		retained := cache.Contains(1)
+		if want := name == evictLFU; retained != want {
+			t.Errorf("%s: frequently used epoch retained %v, want %v", name, retained, want)
+		}
+		if name == evictLFU && (cache.Contains(2) || !cache.Contains(3) || !cache.Contains(4)) {
+			t.Errorf("lfu: evicted the wrong epoch, holding %d values", len(cache.Values()))
+		}
+	}
+}
+
+func TestBasicLRUEvictCallback(t *testing.T) {
+	type eviction struct {
+		key   int
+		value string
+	}
+	var evicted []eviction
+	lru := NewBasicLRUWithEvict[int, string](2, func(key int, value string) {
+		evicted = append(evicted, eviction{key, value})
+	})
+	lru.Add(1, "one")
+	lru.Add(2, "two")
+	lru.Get(1)
+	if !lru.Add(3, "three") {
+		t.Fatal("adding beyond capacity did not evict")
+	}
+	if key, value, ok := lru.RemoveOldest(); !ok || key != 1 || value != "one" {
+		t.Fatalf("removed oldest %d %q (%v), want 1 one", key, value, ok)
+	}
+	// Updating or explicitly removing an item is not an eviction
+	lru.Add(3, "tres")
+	lru.Remove(3)
+
+	if want := []eviction{{2, "two"}, {1, "one"}}; !reflect.DeepEqual(evicted, want) {
+		t.Errorf("evicted %v, want %v", evicted, want)
+	}
+	// Caches without a callback evict silently
+	plain := NewBasicLRU[int, string](1)
+	plain.Add(1, "one")
+	if !plain.Add(2, "two") || plain.Contains(1) {
+		t.Error("cache without callback did not evict")
+	}
+}
+
+func TestCacheStatsConcurrent(t *testing.T) {
+	const (
+		workers = 16
+		lookups = 1000
+	)
+	cache := NewCache[int, int](8)
+	for i := 0; i < 4; i++ {
+		cache.Add(i, i)
+	}
+	// Keys 0-3 are cached, 4-7 are not, so every worker hits and misses
+	// exactly half of its lookups.
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < lookups; i++ {
+				if i%2 == 0 {
+					cache.Get((w + i) % 8)
+				} else {
+					cache.Peek((w + i) % 8)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	hits, misses := cache.Stats()
+	if hits+misses != workers*lookups {
+		t.Errorf("%d hits and %d misses, want %d lookups", hits, misses, workers*lookups)
+	}
+	if hits != workers*lookups/2 {
+		t.Errorf("%d hits, want %d", hits, workers*lookups/2)
+	}
+}
+
+func TestBasicLRUOrder(t *testing.T) {
+	cache := NewBasicLRU[int, string](4)
+	for i, value := range []string{"a", "b", "c", "d"} {
+		cache.Add(i, value)
+	}
+	cache.Get(1)
+	cache.Add(0, "A")
+	cache.Peek(2) // Peeking does not touch the key
+
+	wantKeys, wantValues := []int{0, 1, 3, 2}, []string{"A", "b", "d", "c"}
+	if keys := cache.Keys(); !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("keys %v, want %v", keys, wantKeys)
+	}
+	if values := cache.Values(); !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("values %v, want %v", values, wantValues)
+	}
+	keys, values := cache.Entries()
+	if !reflect.DeepEqual(keys, wantKeys) || !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("entries %v, %v, want %v, %v", keys, values, wantKeys, wantValues)
+	}
+}
+
+func TestCacheLimit(t *testing.T) {
+	for _, limit := range []int{1, 3} {
+		ethash := New(Config{PowMode: ModeTest, CachesInMem: limit, DatasetsInMem: 1}, nil, false)
+		for epoch := uint64(0); epoch < 5; epoch++ {
+			c, _ := ethash.caches.get(epoch, epochLengthDefault, nil)
+			c.unref()
+		}
+		caches, _ := ethash.caches.snapshot()
+		if len(caches) != limit {
+			t.Errorf("limit %d: %d caches in memory", limit, len(caches))
+		}
+		// The most recently used epochs are the ones kept
+		for i, c := range caches {
+			if want := uint64(4 - i); c.epoch != want {
+				t.Errorf("limit %d: cache %d of epoch %d, want %d", limit, i, c.epoch, want)
+			}
+		}
+		ethash.Close()
+	}
+}
+
+func TestLRUConcurrentGeneration(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		created = make(map[uint64]int)
+	)
+	// A single item cache, so the epochs requested below keep evicting each
+	// other before their generation finishes.
+	lru := newlru(1, 1, evictLRU, 0, func(epoch uint64, epochLength uint64) *dataset {
+		mu.Lock()
+		created[epoch]++
+		mu.Unlock()
+		return newDataset(epoch, epochLength)
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				epoch := uint64(5)
+				if (i+j)%4 == 0 {
+					epoch = 7
+				}
+				item, _ := lru.get(epoch, epochLengthDefault, nil)
+				item.unref()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Epochs 5 and 7 are requested, 6 and 8 provisioned as future items
+	want := map[uint64]int{5: 1, 6: 1, 7: 1, 8: 1}
+	if !reflect.DeepEqual(created, want) {
+		t.Errorf("items created per epoch %v, want %v", created, want)
+	}
+}
+
+func TestLRUReleasesEvictedMappings(t *testing.T) {
+	dir := t.TempDir()
+	lru := newlru(1, 1, evictLRU, 0, newCache)
+
+	// generated returns a memory mapped cache for the epoch, still referenced.
+	generated := func(epoch uint64) *cache {
+		c, _ := lru.get(epoch, epochLengthDefault, nil)
+		c.generate(dir, 3, false, true)
+		if c.dump == nil || c.mmap == nil {
+			t.Fatalf("epoch %d: cache not backed by a file", epoch)
+		}
+		return c
+	}
+	closed := func(f *os.File) bool {
+		_, err := f.Stat()
+		return errors.Is(err, os.ErrClosed)
+	}
+
+	// An unused cache is released as soon as it is evicted
+	c := generated(0)
+	dump := c.dump
+	c.unref()
+	generated(2).unref()
+	if !closed(dump) || c.mmap != nil {
+		t.Error("evicted cache still mapped")
+	}
+
+	// A cache in use is only released once its last user is done
+	c = generated(4)
+	dump = c.dump
+	generated(6).unref()
+	if closed(dump) || c.cache == nil {
+		t.Fatal("evicted cache released while in use")
+	}
+	c.unref()
+	if !closed(dump) || c.mmap != nil {
+		t.Error("evicted cache still mapped after its last use")
+	}
+
+	// Purging releases the remaining cache
+	c, _ = lru.get(6, epochLengthDefault, nil)
+	dump = c.dump
+	c.unref()
+	lru.purge()
+	if !closed(dump) || c.mmap != nil {
+		t.Error("purged cache still mapped")
+	}
+}
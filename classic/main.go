@@ -2,12 +2,24 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"math/big"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/openrelayxyz/plugeth-utils/core"
 	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
 )
 
 var (
@@ -22,11 +34,14 @@ var (
 
 	ClassicDNSNetwork1 string = dnsPrefixETC + "all.classic.blockd.info"
 
-	snapDiscoveryURLs []string
+	syncModeFlag    string      // Value of --syncmode as seen by Initialize
+	lightSyncActive atomic.Bool // lightSync as passed to SetETHDiscoveryURLs
 
 	forkBlockIds = []uint64 {1150000, 2500000, 3000000, 5000000, 5900000, 8772000, 9573000, 10500839, 11700000, 13189133, 14525000, 19250000}
 
 	forkTimeIds = []uint64{}
+
+	classicGenesisHash = core.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3")
 )
 
 type ClassicService struct {
@@ -34,6 +49,22 @@ type ClassicService struct {
 	stack   core.Node
 }
 
+// ClassicAdminService holds the plugin's state-changing RPC methods. It is
+// registered in the private admin namespace, which the host only serves over
+// IPC unless explicitly enabled on HTTP or WebSocket.
+type ClassicAdminService struct{}
+
+// RewardCacheService serves plugeth_trimRewardCache. It is registered apart
+// from ClassicService so the allowlist can withhold it on its own.
+type RewardCacheService struct{}
+
+// DatasetService serves plugeth_verifyHeader, which starts the generation of
+// mining datasets. It is registered apart from ClassicService so the allowlist
+// can withhold it on its own.
+type DatasetService struct {
+	classic *ClassicService
+}
+
 var (
 	pl      core.PluginLoader
 	backend restricted.Backend
@@ -41,7 +72,11 @@ var (
 	events  core.Feed
 )
 
+var initializeNodeOnce sync.Once
+
 var (
+	httpFlagName = "http"
+	syncModeFlagName = "syncmode"
 	httpApiFlagName = "http.api"
 	mainnetFlag = "mainnet"
 	goerliFlag = "goerli"
@@ -55,13 +90,8 @@ func Initialize(ctx core.Context, loader core.PluginLoader, logger core.Logger)
 	pl = loader
 	events = pl.GetFeed()
 	log = logger
-	v := ctx.String(httpApiFlagName)
-	if v != "" {
-		ctx.Set(httpApiFlagName, v+",plugeth")
-	} else {
-		ctx.Set(httpApiFlagName, "eth,net,web3,plugeth")
-		
-	}
+	configureHTTPAPI(ctx)
+	syncModeFlag = ctx.String(syncModeFlagName)
 
 	switch {
 		case ctx.Bool(mainnetFlag):
@@ -74,10 +104,95 @@ func Initialize(ctx core.Context, loader core.PluginLoader, logger core.Logger)
 			panic(networkPanicMsg)
 	}
 
+	if err := validateEmbeddedConfig(classicChainConfig); err != nil {
+		panic(fmt.Sprintf("Invalid embedded Classic chain config: %v", err))
+	}
+
+	if *genesisHash != "" {
+		if b, err := hexutil.Decode(*genesisHash); err != nil || len(b) != len(core.Hash{}) {
+			panic(fmt.Sprintf("Invalid --classic.genesis value %q, expected a 32 byte hex hash", *genesisHash))
+		}
+	}
+
+	if *networkIDFlag == 0 {
+		panic("Invalid --classic.networkid value 0")
+	}
+	classicNetworkId = *networkIDFlag
+
+	if *cacheLimit < 1 {
+		panic(fmt.Sprintf("Invalid --classic.cachelimit value %d, at least one cache must be kept in memory", *cacheLimit))
+	}
+
+	if *forkIDsFlag != "" {
+		blocks, err := parseForkIDs(*forkIDsFlag)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid --classic.forkids value %q: %v", *forkIDsFlag, err))
+		}
+		if !sameForks(blocks, forkBlockIds) {
+			log.Warn("Fork ID blocks diverge from the Classic schedule", "configured", blocks, "canonical", forkBlockIds)
+		}
+		forkBlockIds = blocks
+	}
+
+	if *forkCheckURL != "" {
+		if err := checkForkSchedule(*forkCheckURL); err != nil {
+			panic(fmt.Sprintf("Fork schedule check against %s failed, refusing to start: %v", *forkCheckURL, err))
+		}
+		log.Info("Fork schedule matches the trusted checkpoint", "url", *forkCheckURL)
+	}
+
+	if version, ok := hostPlugethUtilsVersion(); ok {
+		if err := checkPlugethUtilsVersion(version); err != nil {
+			panic(err.Error())
+		}
+	} else {
+		log.Warn("Unable to determine the host plugeth-utils version")
+	}
+
+	if *ethashSelfCheck {
+		if err := verifyEthashSizes(); err != nil {
+			panic(fmt.Sprintf("Ethash self-check failed: %v", err))
+		}
+		log.Info("Ethash size constants verified")
+	}
+
+	if *checkBootnodesFlag {
+		checkBootnodes(*bootnodeTimeout)
+	}
 
 	log.Info("Loaded Ethereum Classic plugin")
 }
 
+// configureHTTPAPI adds the plugeth namespace to the HTTP API list. If HTTP is
+// not enabled the flags are left alone, so the plugin never influences whether
+// the HTTP server starts.
+func configureHTTPAPI(ctx core.Context) {
+	if !ctx.Bool(httpFlagName) {
+		return
+	}
+	ctx.Set(httpApiFlagName, withPlugethAPI(ctx.String(httpApiFlagName)))
+}
+
+// withPlugethAPI appends the plugeth namespace to a comma separated http.api
+// value unless it is already listed, defaulting to eth,net,web3,plugeth.
+func withPlugethAPI(v string) string {
+	if v == "" {
+		return "eth,net,web3,plugeth"
+	}
+	for _, api := range strings.Split(v, ",") {
+		if strings.TrimSpace(api) == "plugeth" {
+			return v
+		}
+	}
+	return v + ",plugeth"
+}
+
+// ConsensusEngine returns the consensus engine governing the given block,
+// which is ethash for all of Ethereum Classic.
+func ConsensusEngine(num *big.Int) ConsensusEngineT {
+	return ConsensusEngineT_Ethash
+}
+
 func Is1559(*big.Int) bool {
 	return false
 }
@@ -92,57 +207,328 @@ func IsShanghai(num *big.Int) bool {
 	return r >= 0
 }
 
-func InitializeNode(node core.Node, backend restricted.Backend) {
+// IsMagneto reports whether the Magneto fork (ECIP-1103), Classic's
+// equivalent of Berlin, is active at the given block.
+func IsMagneto(num *big.Int) bool {
+	r := num.Cmp(big.NewInt(13189133))
+	return r >= 0
+}
+
+// IsMystique reports whether the Mystique fork (ECIP-1104) is active at the
+// given block. Mystique is London without EIP-1559: it adopted the refund
+// reduction of EIP-3529 and the 0xEF code rejection of EIP-3541, but Classic
+// has no base fee to burn, which is why Is1559 stays false throughout.
+func IsMystique(num *big.Int) bool {
+	r := num.Cmp(big.NewInt(14525000))
+	return r >= 0
+}
+
+// InitializeNode writes the Classic chain config to the database. The write
+// happens at most once per process, even if the host invokes the hook
+// concurrently.
+func InitializeNode(node core.Node, b restricted.Backend) {
+	initializeNodeOnce.Do(func() {
+		backend = b
+		writeChainConfig(backend)
+		if *startupSummary {
+			logStartupSummary()
+		}
+	})
+}
+
+// logStartupSummary logs the effective configuration of the plugin in a
+// single line.
+func logStartupSummary() {
+	ctx := []interface{}{
+		"network", "classic",
+		"chainId", etc_config.ChainID,
+		"networkId", *SetNetworkId(),
+		"bootnodes", len(ClassicBootnodes),
+		"discovery", ethDiscoveryURL(lightSyncActive.Load()),
+	}
+	if ethash := eHashForAPI; ethash != nil {
+		ctx = append(ctx,
+			"cacheDir", ethash.config.CacheDir,
+			"cachesInMem", ethash.config.CachesInMem,
+			"cachesOnDisk", ethash.config.CachesOnDisk,
+			"datasetDir", ethash.config.DatasetDir,
+			"datasetsInMem", ethash.config.DatasetsInMem,
+			"datasetsOnDisk", ethash.config.DatasetsOnDisk,
+		)
+	}
+	Flags.VisitAll(func(f *flag.Flag) {
+		ctx = append(ctx, f.Name, f.Value.String())
+	})
+	log.Info("Classic plugin configuration", ctx...)
+}
+
+// configGenesisHash returns the genesis hash the chain config is stored under:
+// the --classic.genesis override if set, otherwise the hash of the node's
+// genesis block, falling back to the Classic mainnet genesis on a fresh
+// database.
+func configGenesisHash(backend restricted.Backend) core.Hash {
+	if *genesisHash != "" {
+		return core.HexToHash(*genesisHash)
+	}
+	data, err := backend.HeaderByNumber(context.Background(), 0)
+	if err != nil || len(data) == 0 {
+		return classicGenesisHash
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		log.Warn("Failed to decode genesis header, using the Classic genesis hash", "err", err)
+		return classicGenesisHash
+	}
+	return header.Hash()
+}
+
+// classicChainConfig is the chain config stored for the host under the
+// ethereum-config-<genesis hash> key.
+var classicChainConfig = []byte(`{
+	"chainId": 61,
+	"networkId": 1,
+	"homesteadBlock": 1150000,
+	"daoForkBlock": null,
+	"daoForkSupport": false,
+	"eip150Block": 2500000,
+	"eip155Block": 3000000,
+	"eip158Block": 8772000,
+	"byzantiumBlock": 8772000,
+	"constantinopleBlock": 9573000,
+	"petersburgBlock": 9573000,
+	"istanbulBlock": 10500839,
+	"berlinBlock": 13189133,
+	"londonBlock": 14525000,
+	"ethash": {}
+}`)
+
+// configForkFields lists the fork blocks of the chain config in the order
+// they must activate.
+var configForkFields = []string{
+	"homesteadBlock",
+	"eip150Block",
+	"eip155Block",
+	"eip158Block",
+	"byzantiumBlock",
+	"constantinopleBlock",
+	"petersburgBlock",
+	"istanbulBlock",
+	"berlinBlock",
+	"londonBlock",
+}
+
+// validateEmbeddedConfig checks that the chain config is a valid Classic
+// config with all fork blocks set and activating in order.
+func validateEmbeddedConfig(data []byte) error {
+	if err := validateStoredConfig(data); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var networkID uint64
+	if raw, ok := fields["networkId"]; !ok {
+		return errors.New("missing networkId")
+	} else if err := json.Unmarshal(raw, &networkID); err != nil {
+		return fmt.Errorf("invalid networkId: %w", err)
+	}
+	var last uint64
+	for _, name := range configForkFields {
+		raw, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("missing %s", name)
+		}
+		var block *uint64
+		if err := json.Unmarshal(raw, &block); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		if block == nil {
+			return fmt.Errorf("missing %s", name)
+		}
+		if *block < last {
+			return fmt.Errorf("%s %d activates before the preceding fork at %d", name, *block, last)
+		}
+		last = *block
+	}
+	return nil
+}
+
+// loadChainConfig reads a chain config from a JSON file, checking that the
+// fields required by the host are present.
+func loadChainConfig(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"chainId", "networkId", "ethash"} {
+		if raw, ok := fields[name]; !ok || string(raw) == "null" {
+			return nil, fmt.Errorf("missing %s", name)
+		}
+	}
+	return data, nil
+}
+
+func writeChainConfig(backend restricted.Backend) {
 	db := backend.ChainDb()
+	cfg := classicChainConfig
+
+	if *configPath != "" {
+		if data, err := loadChainConfig(*configPath); err != nil {
+			log.Error("Failed to load chain config, using the embedded Classic config", "path", *configPath, "err", err)
+		} else {
+			cfg = data
+		}
+	}
 
-	cfg := []byte(`{
-		"chainId": 61,
-		"networkId": 1,
-		"homesteadBlock": 1150000,
-		"daoForkBlock": null,
-		"daoForkSupport": false,
-		"eip150Block": 2500000,
-		"eip155Block": 3000000,
-		"eip158Block": 8772000,
-		"byzantiumBlock": 8772000,
-		"constantinopleBlock": 9573000,
-		"petersburgBlock": 9573000,
-		"istanbulBlock": 10500839,
-		"berlinBlock": 13189133,
-		"londonBlock": 14525000,
-		"ethash": {}
-	}`)
-
-	hash := core.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3")
-
-	if err := db.Put(append([]byte("ethereum-config-"), hash.Bytes()...), cfg); err != nil {
+	// The config is always rewritten, so fork schedule changes shipped with
+	// the plugin reach existing datadirs. Replacing a value that is not a
+	// Classic config at all is worth a warning though.
+	key := append([]byte("ethereum-config-"), configGenesisHash(backend).Bytes()...)
+	if existing, err := db.Get(key); err == nil && len(existing) > 0 {
+		if err := validateStoredConfig(existing); err != nil {
+			log.Warn("Replacing foreign chain config stored under the Classic genesis key", "err", err)
+		}
+	}
+	if err := db.Put(key, cfg); err != nil {
 		log.Error("Error loading Classic config", "err", err)
 	}
 }
 
+// validateStoredConfig checks that a config found under the Classic genesis
+// key is an ethash config for the Classic chain id, rather than a value
+// written by another plugin or process.
+func validateStoredConfig(data []byte) error {
+	var stored struct {
+		ChainID *big.Int         `json:"chainId"`
+		Ethash  *json.RawMessage `json:"ethash"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	if stored.ChainID == nil || stored.ChainID.Cmp(etc_config.ChainID) != 0 {
+		return fmt.Errorf("unexpected chain id %v", stored.ChainID)
+	}
+	if stored.Ethash == nil {
+		return errors.New("missing ethash config")
+	}
+	return nil
+}
+
+// namedAPI is an API together with the allowlist entry that registers it:
+// the namespace for services holding read-only methods, or namespace_method
+// for services holding a single sensitive method.
+type namedAPI struct {
+	name string
+	api  core.API
+}
+
 func GetAPIs(stack core.Node, backend core.Backend) []core.API {
-	return []core.API{
-		{
-			Namespace: "plugeth",
-			Version:   "1.0",
-			Service:   &ClassicService{backend, stack},
-			Public:    true,
-		},
-		{
-			Namespace: "eth",
-			Version:   "1.0",
-			Service:   &API{eHashForAPI},
-			Public:    true,
-		},
+	return filterAPIs(classicAPIs(stack, backend), *rpcAllowlist)
+}
+
+// classicAPIs returns every API the plugin can register.
+func classicAPIs(stack core.Node, backend core.Backend) []namedAPI {
+	service := &ClassicService{backend, stack}
+	return []namedAPI{
+		{"plugeth", core.API{Namespace: "plugeth", Version: "1.0", Service: service, Public: true}},
+		{"plugeth_trimRewardCache", core.API{Namespace: "plugeth", Version: "1.0", Service: &RewardCacheService{}, Public: true}},
+		{"plugeth_verifyHeader", core.API{Namespace: "plugeth", Version: "1.0", Service: &DatasetService{service}, Public: true}},
+		{"eth", core.API{Namespace: "eth", Version: "1.0", Service: &API{eHashForAPI}, Public: true}},
+		{"admin_clearReorgAlert", core.API{Namespace: "admin", Version: "1.0", Service: &ClassicAdminService{}, Public: false}},
+	}
+}
+
+// filterAPIs drops any API whose name is not part of the comma separated
+// allowlist. The host merges services registered under the same namespace, so
+// sensitive methods can be withheld while the rest of their namespace stays
+// available.
+func filterAPIs(apis []namedAPI, allowlist string) []core.API {
+	allowed := make(map[string]bool)
+	for _, name := range strings.Split(allowlist, ",") {
+		allowed[strings.TrimSpace(name)] = true
+	}
+	result := make([]core.API, 0, len(apis))
+	for _, api := range apis {
+		if !allowed[api.name] {
+			log.Info("Withholding classic RPC methods", "name", api.name)
+			continue
+		}
+		delete(allowed, api.name)
+		result = append(result, api.api)
+	}
+	for name := range allowed {
+		if name != "" {
+			log.Warn("Unknown classic RPC allowlist entry", "name", name)
+		}
 	}
+	return result
 }
 
 // type API struct {
 // 	ethash *Ethash
 // }
 
-func ForkIDs([]uint64, []uint64) ([]uint64, []uint64) {
-	return forkBlockIds, forkTimeIds
+// parseForkIDs parses a comma separated list of fork blocks, which must be
+// strictly increasing.
+func parseForkIDs(list string) ([]uint64, error) {
+	var blocks []uint64
+	for _, field := range strings.Split(list, ",") {
+		block, err := strconv.ParseUint(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(blocks); n > 0 && block <= blocks[n-1] {
+			return nil, fmt.Errorf("fork block %d does not follow %d", block, blocks[n-1])
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// sameForks reports whether both fork lists hold the same values in the same
+// order.
+func sameForks(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeForks returns the sorted union of the given fork lists. Zero entries
+// are dropped, as forks active at genesis are not part of the fork ID.
+func mergeForks(lists ...[]uint64) []uint64 {
+	merged := []uint64{}
+	for _, list := range lists {
+		for _, fork := range list {
+			if fork != 0 {
+				merged = append(merged, fork)
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i] < merged[j] })
+	result := merged[:0]
+	for i, fork := range merged {
+		if i == 0 || fork != merged[i-1] {
+			result = append(result, fork)
+		}
+	}
+	return result
+}
+
+// ForkIDs merges the fork blocks and times computed by the host with the
+// Classic schedule, returning both lists sorted and deduplicated.
+func ForkIDs(blocks []uint64, times []uint64) ([]uint64, []uint64) {
+	return mergeForks(blocks, forkBlockIds), mergeForks(times, forkTimeIds)
 }
 
 func SetDefaultDataDir(path string) string {
@@ -154,11 +540,24 @@ func OpCodeSelect() []int {
 	return codes
 }
 
+// OpCodeSelectAt returns the opcodes disabled at the given block. BASEFEE is
+// never available on Classic, PUSH0 only becomes available with Spiral.
+func OpCodeSelectAt(num *big.Int) []int {
+	codes := OpCodeSelect()
+	if !IsShanghai(num) {
+		codes = append(codes, 0x5f)
+	}
+	return codes
+}
+
+// classicNetworkId is the network ID returned by SetNetworkId, overridden by
+// --classic.networkid in Initialize.
+var classicNetworkId = uint64(1)
+
+// SetNetworkId returns the network ID of the node. The same pointer is
+// returned on every call.
 func SetNetworkId() *uint64 {
-	var networkId *uint64
-	classicNetworkId := uint64(1)
-	networkId = &classicNetworkId
-	return networkId 
+	return &classicNetworkId
 }
 
 func SetBootstrapNodes() []string {
@@ -166,20 +565,38 @@ func SetBootstrapNodes() []string {
 	return result
 }
 
-func SetETHDiscoveryURLs(lightSync bool) []string {
-
-	url := ClassicDNSNetwork1
-	if lightSync == true {
-		url = strings.ReplaceAll(url, "all", "les")
+// ethDiscoveryURL returns the DNS discovery tree for the eth protocol, the
+// les tree for light clients.
+func ethDiscoveryURL(lightSync bool) string {
+	if lightSync {
+		return strings.Replace(ClassicDNSNetwork1, "@all.", "@les.", 1)
 	}
-	result := []string{url}
-	snapDiscoveryURLs = result
+	return ClassicDNSNetwork1
+}
 
-	return result
+func SetETHDiscoveryURLs(lightSync bool) []string {
+	lightSyncActive.Store(lightSync)
+	return []string{ethDiscoveryURL(lightSync)}
 }
 
+// SetSnapDiscoveryURLs returns the snap DNS discovery tree. It is derived from
+// ClassicDNSNetwork1 directly, so it does not depend on SetETHDiscoveryURLs
+// having been called first.
 func SetSnapDiscoveryURLs() []string {
-	return snapDiscoveryURLs
+	return []string{strings.Replace(ClassicDNSNetwork1, "@all.", "@snap.", 1)}
+}
+
+// SyncMode reports the sync mode as the plugin sees it: "light" if the
+// discovery URLs were requested for light sync, otherwise the --syncmode flag,
+// defaulting to "snap".
+func (service *ClassicService) SyncMode(ctx context.Context) (string, error) {
+	if lightSyncActive.Load() {
+		return "light", nil
+	}
+	if syncModeFlag != "" {
+		return syncModeFlag, nil
+	}
+	return "snap", nil
 }
 
 func (service *ClassicService) Test(ctx context.Context) string {
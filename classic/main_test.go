@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// testLogger discards everything logged by the plugin during tests.
+type testLogger struct{}
+
+func (testLogger) Trace(string, ...interface{}) {}
+func (testLogger) Debug(string, ...interface{}) {}
+func (testLogger) Info(string, ...interface{})  {}
+func (testLogger) Warn(string, ...interface{})  {}
+func (testLogger) Crit(string, ...interface{})  {}
+func (testLogger) Error(string, ...interface{}) {}
+
+// recordingLogger keeps the messages logged at info level, along with their
+// context.
+type recordingLogger struct {
+	testLogger
+	mu       sync.Mutex
+	messages map[string][]interface{}
+}
+
+func (l *recordingLogger) Info(msg string, ctx ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages[msg] = ctx
+}
+
+// withRecordingLogger records the plugin's info logs for the duration of the
+// test.
+func withRecordingLogger(t *testing.T) *recordingLogger {
+	recorder := &recordingLogger{messages: make(map[string][]interface{})}
+	old := log
+	log = recorder
+	t.Cleanup(func() { log = old })
+	return recorder
+}
+
+func TestMain(m *testing.M) {
+	log = testLogger{}
+	os.Exit(m.Run())
+}
+
+// testBackend serves a chain of headers, and optionally blocks, from memory.
+// Backend methods it does not override panic, the embedded interface being
+// nil.
+type testBackend struct {
+	core.Backend
+	headers map[int64]*types.Header
+	blocks  map[core.Hash]*types.Block // Canonical and side chain blocks
+	head    int64
+}
+
+// newTestBackend creates a backend whose chain holds the given headers, the
+// last one being the head.
+func newTestBackend(headers ...*types.Header) *testBackend {
+	b := &testBackend{headers: make(map[int64]*types.Header), blocks: make(map[core.Hash]*types.Block)}
+	for _, header := range headers {
+		b.headers[header.Number.Int64()] = header
+		b.head = header.Number.Int64()
+	}
+	return b
+}
+
+// newTestChain creates a backend whose chain holds the given blocks, the last
+// one being the head.
+func newTestChain(blocks ...*types.Block) *testBackend {
+	b := newTestBackend()
+	for _, block := range blocks {
+		b.headers[block.Number().Int64()] = block.Header()
+		b.blocks[block.Hash()] = block
+		b.head = block.Number().Int64()
+	}
+	return b
+}
+
+func (b *testBackend) CurrentHeader() []byte {
+	data, _ := rlp.EncodeToBytes(b.headers[b.head])
+	return data
+}
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number int64) ([]byte, error) {
+	if number < 0 {
+		number = b.head
+	}
+	header, ok := b.headers[number]
+	if !ok {
+		return nil, nil
+	}
+	return rlp.EncodeToBytes(header)
+}
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number int64) ([]byte, error) {
+	if number < 0 {
+		number = b.head
+	}
+	header, ok := b.headers[number]
+	if !ok {
+		return nil, nil
+	}
+	return b.BlockByHash(ctx, header.Hash())
+}
+
+func (b *testBackend) BlockByHash(ctx context.Context, hash core.Hash) ([]byte, error) {
+	block, ok := b.blocks[hash]
+	if !ok {
+		return nil, nil
+	}
+	return rlp.EncodeToBytes(block)
+}
+
+// testHeader returns a header with the given number.
+func testHeader(number int64) *types.Header {
+	return &types.Header{Number: big.NewInt(number), Difficulty: big.NewInt(1)}
+}
+
+// testService returns a service backed by a chain whose head has the given
+// number.
+func testService(head int64) *ClassicService {
+	return &ClassicService{backend: newTestBackend(testHeader(head))}
+}
+
+// registeredMethods lists the RPC methods the host would serve for apis, named
+// namespace_method as on the wire.
+func registeredMethods(apis []core.API) map[string]bool {
+	methods := make(map[string]bool)
+	for _, api := range apis {
+		typ := reflect.TypeOf(api.Service)
+		for i := 0; i < typ.NumMethod(); i++ {
+			name := typ.Method(i).Name
+			methods[api.Namespace+"_"+strings.ToLower(name[:1])+name[1:]] = true
+		}
+	}
+	return methods
+}
+
+func TestFilterAPIs(t *testing.T) {
+	sensitive := []string{"plugeth_trimRewardCache", "plugeth_verifyHeader", "admin_clearReorgAlert"}
+
+	all := registeredMethods(filterAPIs(classicAPIs(nil, nil), *rpcAllowlist))
+	for _, method := range append(sensitive, "plugeth_blockReward", "eth_getWork") {
+		if !all[method] {
+			t.Errorf("default allowlist does not register %s", method)
+		}
+	}
+
+	readOnly := registeredMethods(filterAPIs(classicAPIs(nil, nil), "plugeth, eth"))
+	for _, method := range sensitive {
+		if readOnly[method] {
+			t.Errorf("read-only allowlist registers %s", method)
+		}
+	}
+	for _, method := range []string{"plugeth_blockReward", "plugeth_chainParameters", "eth_submitWork"} {
+		if !readOnly[method] {
+			t.Errorf("read-only allowlist does not register %s", method)
+		}
+	}
+
+	single := registeredMethods(filterAPIs(classicAPIs(nil, nil), "plugeth_trimRewardCache,unknown"))
+	if len(single) != 1 || !single["plugeth_trimRewardCache"] {
+		t.Errorf("registered %v, want only plugeth_trimRewardCache", single)
+	}
+}
+
+// testChainDb is an in-memory key-value store. Database methods it does not
+// override panic, the embedded interface being nil.
+type testChainDb struct {
+	restricted.Database
+	values map[string][]byte
+	puts   int
+}
+
+func (db *testChainDb) Get(key []byte) ([]byte, error) {
+	value, ok := db.values[string(key)]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return value, nil
+}
+
+func (db *testChainDb) Put(key, value []byte) error {
+	db.values[string(key)] = value
+	db.puts++
+	return nil
+}
+
+// testRestrictedBackend serves a testChainDb and an optional genesis header.
+// Without one the Classic genesis hash is used as config key.
+type testRestrictedBackend struct {
+	restricted.Backend
+	db      *testChainDb
+	genesis *types.Header
+}
+
+func (b *testRestrictedBackend) ChainDb() restricted.Database { return b.db }
+
+func (b *testRestrictedBackend) HeaderByNumber(ctx context.Context, number int64) ([]byte, error) {
+	if number != 0 || b.genesis == nil {
+		return nil, nil
+	}
+	return rlp.EncodeToBytes(b.genesis)
+}
+
+func TestWriteChainConfig(t *testing.T) {
+	key := string(append([]byte("ethereum-config-"), classicGenesisHash.Bytes()...))
+	stale := []byte(`{"chainId": 61, "ethash": {}, "homesteadBlock": 1}`)
+	tests := []struct {
+		name   string
+		stored []byte
+		want   []byte
+	}{
+		{"missing", nil, classicChainConfig},
+		{"garbage", []byte("not a chain config"), classicChainConfig},
+		{"wrong chain id", []byte(`{"chainId": 1, "ethash": {}}`), classicChainConfig},
+		{"missing ethash", []byte(`{"chainId": 61}`), classicChainConfig},
+		{"stale classic config", stale, classicChainConfig},
+	}
+	for _, tt := range tests {
+		db := &testChainDb{values: make(map[string][]byte)}
+		if tt.stored != nil {
+			db.values[key] = tt.stored
+		}
+		writeChainConfig(&testRestrictedBackend{db: db})
+		if got := db.values[key]; !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: stored config %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteChainConfigFile(t *testing.T) {
+	key := string(append([]byte("ethereum-config-"), classicGenesisHash.Bytes()...))
+	dir := t.TempDir()
+	custom := []byte(`{"chainId": 61, "networkId": 1, "homesteadBlock": 5, "ethash": {}}`)
+
+	tests := []struct {
+		name    string
+		content []byte // Nil for a missing file
+		want    []byte
+	}{
+		{"custom config", custom, custom},
+		{"missing file", nil, classicChainConfig},
+		{"invalid json", []byte(`{"chainId": 61,`), classicChainConfig},
+		{"missing ethash", []byte(`{"chainId": 61, "networkId": 1}`), classicChainConfig},
+		{"null network id", []byte(`{"chainId": 61, "networkId": null, "ethash": {}}`), classicChainConfig},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("config%d.json", i))
+		if tt.content != nil {
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		setFlag(t, "classic.config", path)
+
+		// The stored config is replaced by the file, or the embedded config if unusable
+		db := &testChainDb{values: map[string][]byte{key: []byte(`{"chainId": 61, "ethash": {}}`)}}
+		writeChainConfig(&testRestrictedBackend{db: db})
+		if got := db.values[key]; !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: stored config %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConfigGenesisHash(t *testing.T) {
+	configKey := func(hash core.Hash) string {
+		return string(append([]byte("ethereum-config-"), hash.Bytes()...))
+	}
+	genesis := &types.Header{Number: new(big.Int), Difficulty: big.NewInt(131072), Extra: []byte("private network")}
+	override := core.HexToHash("0x1234")
+
+	tests := []struct {
+		name     string
+		flag     string
+		genesis  *types.Header
+		wantHash core.Hash
+	}{
+		{"fresh database", "", nil, classicGenesisHash},
+		{"node genesis", "", genesis, genesis.Hash()},
+		{"override", hexutil.Encode(override.Bytes()), genesis, override},
+	}
+	for _, tt := range tests {
+		setFlag(t, "classic.genesis", tt.flag)
+		db := &testChainDb{values: make(map[string][]byte)}
+		writeChainConfig(&testRestrictedBackend{db: db, genesis: tt.genesis})
+
+		if len(db.values) != 1 || db.values[configKey(tt.wantHash)] == nil {
+			t.Errorf("%s: config not stored under genesis %x", tt.name, tt.wantHash)
+		}
+	}
+}
+
+func TestInitializeNodeConcurrent(t *testing.T) {
+	setFlag(t, "classic.startupsummary", "false")
+	initializeNodeOnce = sync.Once{}
+	t.Cleanup(func() {
+		initializeNodeOnce = sync.Once{}
+		backend = nil
+	})
+	db := &testChainDb{values: make(map[string][]byte)}
+
+	var (
+		wg      sync.WaitGroup
+		configs = make([]*PluginConfigurator, 16)
+	)
+	for i := range configs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			InitializeNode(nil, &testRestrictedBackend{db: db})
+			configs[i] = NewPluginConfig()
+		}(i)
+	}
+	wg.Wait()
+
+	if db.puts != 1 {
+		t.Errorf("chain config written %d times, want once", db.puts)
+	}
+	for i, config := range configs {
+		if config != configs[0] {
+			t.Errorf("goroutine %d got configurator %p, want %p", i, config, configs[0])
+		}
+	}
+}
+
+// testContext holds the host's command line flags in memory.
+type testContext struct {
+	strings map[string]string
+	bools   map[string]bool
+}
+
+func (ctx *testContext) Set(name, value string) error {
+	ctx.strings[name] = value
+	return nil
+}
+
+func (ctx *testContext) String(name string) string { return ctx.strings[name] }
+func (ctx *testContext) Bool(name string) bool     { return ctx.bools[name] }
+
+func TestConfigureHTTPAPI(t *testing.T) {
+	tests := []struct {
+		name string
+		http bool
+		api  string
+		want string
+	}{
+		{"http disabled", false, "", ""},
+		{"http disabled with api", false, "eth", "eth"},
+		{"http enabled without api", true, "", "eth,net,web3,plugeth"},
+		{"http enabled with api", true, "eth,debug", "eth,debug,plugeth"},
+		{"http enabled with plugeth", true, "eth,plugeth,debug", "eth,plugeth,debug"},
+		{"http enabled with spaced plugeth", true, "eth, plugeth", "eth, plugeth"},
+	}
+	for _, tt := range tests {
+		ctx := &testContext{strings: make(map[string]string), bools: map[string]bool{httpFlagName: tt.http}}
+		if tt.api != "" {
+			ctx.strings[httpApiFlagName] = tt.api
+		}
+		// Configuring twice must not list plugeth twice
+		configureHTTPAPI(ctx)
+		configureHTTPAPI(ctx)
+
+		if api := ctx.strings[httpApiFlagName]; api != tt.want {
+			t.Errorf("%s: http.api %q, want %q", tt.name, api, tt.want)
+		}
+	}
+}
+
+func TestSyncMode(t *testing.T) {
+	t.Cleanup(func() {
+		lightSyncActive.Store(false)
+		syncModeFlag = ""
+	})
+	service := new(ClassicService)
+
+	tests := []struct {
+		flag  string
+		light bool
+		want  string
+	}{
+		{"", false, "snap"},
+		{"full", false, "full"},
+		{"full", true, "light"},
+		{"", true, "light"},
+	}
+	for _, tt := range tests {
+		syncModeFlag = tt.flag
+		lightSyncActive.Store(false)
+		SetETHDiscoveryURLs(tt.light)
+
+		if mode, err := service.SyncMode(context.Background()); err != nil || mode != tt.want {
+			t.Errorf("syncmode %q, light sync %v: mode %q (error %v), want %q", tt.flag, tt.light, mode, err, tt.want)
+		}
+	}
+}
+
+func TestStartupSummary(t *testing.T) {
+	initializeNodeOnce = sync.Once{}
+	t.Cleanup(func() {
+		initializeNodeOnce = sync.Once{}
+		backend = nil
+	})
+	newTestEthash(t)
+	recorder := withRecordingLogger(t)
+	InitializeNode(nil, &testRestrictedBackend{db: &testChainDb{values: make(map[string][]byte)}})
+
+	ctx, ok := recorder.messages["Classic plugin configuration"]
+	if !ok {
+		t.Fatal("startup summary not logged")
+	}
+	fields := make(map[string]string)
+	for i := 0; i+1 < len(ctx); i += 2 {
+		fields[ctx[i].(string)] = fmt.Sprint(ctx[i+1])
+	}
+	want := map[string]string{
+		"network":                "classic",
+		"chainId":                "61",
+		"networkId":              "1",
+		"bootnodes":              fmt.Sprint(len(ClassicBootnodes)),
+		"cachesInMem":            "2",
+		"datasetsInMem":          "1",
+		"classic.startupsummary": "true",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("summary field %s: %q, want %q", key, fields[key], value)
+		}
+	}
+
+	// Disabled summaries are not logged
+	setFlag(t, "classic.startupsummary", "false")
+	initializeNodeOnce = sync.Once{}
+	recorder.messages = make(map[string][]interface{})
+	InitializeNode(nil, &testRestrictedBackend{db: &testChainDb{values: make(map[string][]byte)}})
+	if _, ok := recorder.messages["Classic plugin configuration"]; ok {
+		t.Error("startup summary logged with --classic.startupsummary=false")
+	}
+}
+
+func TestValidateEmbeddedConfig(t *testing.T) {
+	if err := validateEmbeddedConfig(classicChainConfig); err != nil {
+		t.Fatalf("embedded config rejected: %v", err)
+	}
+	replace := func(old, new string) []byte {
+		return bytes.Replace(classicChainConfig, []byte(old), []byte(new), 1)
+	}
+	tests := []struct {
+		name   string
+		config []byte
+	}{
+		{"truncated", classicChainConfig[:len(classicChainConfig)/2]},
+		{"typo in a key", replace(`"berlinBlock"`, `"berlinBlok"`)},
+		{"null fork block", replace(`"eip155Block": 3000000`, `"eip155Block": null`)},
+		{"fork out of order", replace(`"istanbulBlock": 10500839`, `"istanbulBlock": 9000000`)},
+		{"string fork block", replace(`"londonBlock": 14525000`, `"londonBlock": "14525000"`)},
+		{"missing network id", replace(`"networkId": 1,`, ``)},
+		{"wrong chain id", replace(`"chainId": 61`, `"chainId": 1`)},
+	}
+	for _, tt := range tests {
+		if bytes.Equal(tt.config, classicChainConfig) {
+			t.Fatalf("%s: config not modified", tt.name)
+		}
+		if err := validateEmbeddedConfig(tt.config); err == nil {
+			t.Errorf("%s: malformed config accepted", tt.name)
+		}
+	}
+}
+
+func TestParseForkIDs(t *testing.T) {
+	tests := []struct {
+		list   string
+		blocks []uint64
+		fail   bool
+	}{
+		{"1150000", []uint64{1150000}, false},
+		{"1150000, 2500000,3000000", []uint64{1150000, 2500000, 3000000}, false},
+		{"2500000,1150000", nil, true},
+		{"1150000,1150000", nil, true},
+		{"1150000,", nil, true},
+		{"homestead", nil, true},
+	}
+	for _, tt := range tests {
+		blocks, err := parseForkIDs(tt.list)
+		if (err != nil) != tt.fail {
+			t.Errorf("%q: error %v, want failure %v", tt.list, err, tt.fail)
+		}
+		if !reflect.DeepEqual(blocks, tt.blocks) {
+			t.Errorf("%q: blocks %v, want %v", tt.list, blocks, tt.blocks)
+		}
+	}
+}
+
+func TestOpCodeSelectAt(t *testing.T) {
+	tests := []struct {
+		number int64
+		codes  []int
+	}{
+		{0, []int{0x48, 0x5f}},
+		{19_249_999, []int{0x48, 0x5f}},
+		{19_250_000, []int{0x48}},
+		{19_250_001, []int{0x48}},
+	}
+	for _, tt := range tests {
+		if codes := OpCodeSelectAt(big.NewInt(tt.number)); !reflect.DeepEqual(codes, tt.codes) {
+			t.Errorf("block %d: disabled opcodes %#x, want %#x", tt.number, codes, tt.codes)
+		}
+	}
+	if codes := OpCodeSelect(); !reflect.DeepEqual(codes, []int{0x48}) {
+		t.Errorf("disabled opcodes %#x, want [0x48]", codes)
+	}
+}
+
+func TestForkIDsMerge(t *testing.T) {
+	// Without incoming forks the Classic schedule is returned unchanged
+	blocks, times := ForkIDs(nil, nil)
+	if !reflect.DeepEqual(blocks, forkBlockIds) || len(times) != 0 {
+		t.Errorf("fork IDs %v, %v, want %v, []", blocks, times, forkBlockIds)
+	}
+
+	defer func(times []uint64) { forkTimeIds = times }(forkTimeIds)
+	forkTimeIds = []uint64{1_700_000_000}
+
+	blocks, times = ForkIDs([]uint64{0, 19_250_000, 1_150_000, 25_000_000}, []uint64{1_800_000_000, 0, 1_700_000_000, 1_600_000_000})
+	if want := append(append([]uint64{}, forkBlockIds...), 25_000_000); !reflect.DeepEqual(blocks, want) {
+		t.Errorf("fork blocks %v, want %v", blocks, want)
+	}
+	if want := []uint64{1_600_000_000, 1_700_000_000, 1_800_000_000}; !reflect.DeepEqual(times, want) {
+		t.Errorf("fork times %v, want %v", times, want)
+	}
+}
+
+func TestSnapDiscoveryURLs(t *testing.T) {
+	want := []string{dnsPrefixETC + "snap.classic.blockd.info"}
+
+	// Requested before the eth URLs, as well as after them for light sync
+	if urls := SetSnapDiscoveryURLs(); !reflect.DeepEqual(urls, want) {
+		t.Errorf("snap discovery URLs %v, want %v", urls, want)
+	}
+	SetETHDiscoveryURLs(true)
+	t.Cleanup(func() { lightSyncActive.Store(false) })
+	if urls := SetSnapDiscoveryURLs(); !reflect.DeepEqual(urls, want) {
+		t.Errorf("snap discovery URLs after light sync %v, want %v", urls, want)
+	}
+}
+
+// testLoader hands out a testFeed. PluginLoader methods it does not override
+// panic, the embedded interface being nil.
+type testLoader struct {
+	core.PluginLoader
+	feed *testFeed
+}
+
+func (l *testLoader) GetFeed() core.Feed { return l.feed }
+
+func TestNetworkID(t *testing.T) {
+	oldLoader, oldEvents, oldSyncMode, oldNetworkID := pl, events, syncModeFlag, classicNetworkId
+	t.Cleanup(func() {
+		pl, events, log, syncModeFlag, classicNetworkId = oldLoader, oldEvents, testLogger{}, oldSyncMode, oldNetworkID
+	})
+	initialize := func() {
+		ctx := &testContext{strings: make(map[string]string), bools: make(map[string]bool)}
+		Initialize(ctx, &testLoader{feed: new(testFeed)}, testLogger{})
+	}
+
+	// The pointer stays the same, while the value follows the flag
+	id := SetNetworkId()
+	initialize()
+	if SetNetworkId() != id || *id != 1 {
+		t.Errorf("default network ID %d, want 1 behind the same pointer", *SetNetworkId())
+	}
+	setFlag(t, "classic.networkid", "4242")
+	initialize()
+	if SetNetworkId() != id || *id != 4242 {
+		t.Errorf("overridden network ID %d, want 4242 behind the same pointer", *SetNetworkId())
+	}
+}
@@ -313,12 +313,14 @@ func (c *PluginConfigurator) GetForkCanonHashes() map[uint64]core.Hash {
 	return c.RequireBlockHashes
 }
 
-// func (c *PluginConfigurator) GetConsensusEngineType() ConsensusEngineT {
-// 	if c.Ethash != nil {
-// 		return ConsensusEngineT_Ethash
-// 	}
-// 	return ConsensusEngineT_Unknown
-// }
+// GetConsensusEngineType returns the engine sealing the chain's blocks, which
+// is ethash unless a Clique config is present.
+func (c *PluginConfigurator) GetConsensusEngineType() ConsensusEngineT {
+	if c.Clique != nil {
+		return ConsensusEngineT_Clique
+	}
+	return ConsensusEngineT_Ethash
+}
 
 func (c *PluginConfigurator) GetIsDevMode() bool {
 	return c.IsDevMode
@@ -481,6 +483,11 @@ func (c *PluginConfigurator) GetEthashECIP1017EraRounds() *uint64 {
 	return bigNewU64(c.ECIP1017EraRounds)
 }
 
+func (c *PluginConfigurator) GetEthashECIP1017EraRoundsSchedule() Uint64BigMapEncodesHex {
+	
+	return c.ECIP1017EraRoundsSchedule
+}
+
 func (c *PluginConfigurator) GetEthashEIP100BTransition() *uint64 {
 	
 	return bigNewU64(c.EIP100FBlock)
@@ -5,11 +5,25 @@ import (
 	"sort"
 	"math/big"
 	"errors"
+	"sync"
 
 	"github.com/openrelayxyz/plugeth-utils/core"
 )
 
+var pluginConfigOnce sync.Once
+
+// NewPluginConfig returns the shared Classic configurator. The lazily inferred
+// transitions are resolved on first use so that concurrent readers never race
+// on writing them.
 func NewPluginConfig() *PluginConfigurator {
+	pluginConfigOnce.Do(func() {
+		etc_config.GetEthashEIP649Transition()
+		etc_config.GetEthashEIP1234Transition()
+		etc_config.GetEthashEIP2384Transition()
+		etc_config.GetEthashEIP3554Transition()
+		etc_config.GetEthashEIP4345Transition()
+		etc_config.GetEthashEIP5133Transition()
+	})
 	return etc_config
 }
 
@@ -160,6 +174,9 @@ type PluginConfigurator struct {
 	ECIP1010Length     *big.Int `json:"ecip1010Length,omitempty"`     // ECIP1010 length
 	ECIP1017FBlock     *big.Int `json:"ecip1017FBlock,omitempty"`
 	ECIP1017EraRounds  *big.Int `json:"ecip1017EraRounds,omitempty"` // ECIP1017 era rounds
+	// ECIP1017EraRoundsSchedule changes the era rounds from the given block on.
+	// A new era starts at each activation block.
+	ECIP1017EraRoundsSchedule Uint64BigMapEncodesHex `json:"ecip1017EraRoundsSchedule,omitempty"`
 	ECIP1080FBlock     *big.Int `json:"ecip1080FBlock,omitempty"`
 
 	ECIP1099FBlock *big.Int `json:"ecip1099FBlock,omitempty"` // ECIP1099 etchash HF block
@@ -222,6 +239,7 @@ type PluginConfigurator struct {
 
 	// Various consensus engines
 	// Ethash    *ctypes.EthashConfig `json:"ethash,omitempty"`
+	Clique    *CliqueConfig        `json:"clique,omitempty"`
 	IsDevMode bool                 `json:"isDev,omitempty"`
 
 	TrustedCheckpoint       TrustedCheckpoint      `json:"trustedCheckpoint,omitempty"`
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// DeepReorgEvent is published on the plugin feed when a reorg deeper than
+// --classic.maxsafereorg occurs.
+type DeepReorgEvent struct {
+	CommonBlock core.Hash `json:"commonBlock"`
+	Dropped     int       `json:"dropped"`
+	Added       int       `json:"added"`
+	Threshold   uint64    `json:"threshold"`
+	Time        time.Time `json:"time"`
+}
+
+// reorgMonitor keeps track of the most recent deep reorg and whether the node
+// is considered degraded because of it.
+type reorgMonitor struct {
+	mu       sync.Mutex
+	last     *DeepReorgEvent
+	degraded bool
+}
+
+var reorgs = &reorgMonitor{}
+
+// observe checks a reorg against the threshold, returning the alert raised
+// for it, if any.
+func (m *reorgMonitor) observe(common core.Hash, dropped, added int, threshold uint64, degrade bool) *DeepReorgEvent {
+	if threshold == 0 || uint64(dropped) <= threshold {
+		return nil
+	}
+	event := &DeepReorgEvent{
+		CommonBlock: common,
+		Dropped:     dropped,
+		Added:       added,
+		Threshold:   threshold,
+		Time:        time.Now(),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.last = event
+	if degrade {
+		m.degraded = true
+	}
+	return event
+}
+
+// Reorg is invoked by PluGeth whenever the canonical chain is reorganised.
+func Reorg(commonBlock core.Hash, oldChain []core.Hash, newChain []core.Hash) {
+	event := reorgs.observe(commonBlock, len(oldChain), len(newChain), *maxSafeReorg, *reorgDegrade)
+	if event == nil {
+		return
+	}
+	log.Error("Deep chain reorganisation detected", "common", commonBlock, "dropped", event.Dropped, "added", event.Added, "threshold", event.Threshold)
+	publish(topicDeepReorg, *event)
+}
+
+// ReorgStatusResult reports the most recent deep reorg and whether the node
+// is flagged as degraded because of it.
+type ReorgStatusResult struct {
+	Degraded  bool            `json:"degraded"`
+	Threshold uint64          `json:"threshold"`
+	Last      *DeepReorgEvent `json:"last"`
+}
+
+// ReorgStatus returns the most recent deep reorg, if any, and whether the
+// node is flagged as degraded.
+func (service *ClassicService) ReorgStatus(ctx context.Context) (*ReorgStatusResult, error) {
+	reorgs.mu.Lock()
+	defer reorgs.mu.Unlock()
+
+	return &ReorgStatusResult{
+		Degraded:  reorgs.degraded,
+		Threshold: *maxSafeReorg,
+		Last:      reorgs.last,
+	}, nil
+}
+
+// ClearReorgAlert clears the degraded flag raised by a deep reorg. It returns
+// whether the flag was set.
+func (service *ClassicAdminService) ClearReorgAlert(ctx context.Context) (bool, error) {
+	reorgs.mu.Lock()
+	defer reorgs.mu.Unlock()
+
+	degraded := reorgs.degraded
+	reorgs.degraded = false
+	return degraded, nil
+}
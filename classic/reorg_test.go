@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// setFlag sets a plugin flag for the duration of the test.
+func setFlag(t *testing.T, name, value string) {
+	old := Flags.Lookup(name).Value.String()
+	if err := Flags.Set(name, value); err != nil {
+		t.Fatalf("failed to set --%s: %v", name, err)
+	}
+	t.Cleanup(func() { Flags.Set(name, old) })
+}
+
+func TestDeepReorgAlert(t *testing.T) {
+	feed := withTestFeed(t)
+	setFlag(t, "classic.maxsafereorg", "3")
+	setFlag(t, "classic.reorgdegrade", "true")
+	t.Cleanup(func() { reorgs = &reorgMonitor{} })
+
+	// A DAG generation event sent first must not break later alerts
+	publishDAGEvent(DAGGenerationEvent{Stage: "started"})
+
+	hashes := func(n int) []core.Hash { return make([]core.Hash, n) }
+
+	Reorg(core.Hash{1}, hashes(3), hashes(4))
+	if alerts := feed.published(topicDeepReorg); len(alerts) != 0 {
+		t.Fatalf("reorg at the threshold raised %d alerts", len(alerts))
+	}
+	Reorg(core.Hash{2}, hashes(5), hashes(6))
+	alerts := feed.published(topicDeepReorg)
+	if len(alerts) != 1 {
+		t.Fatalf("deep reorg raised %d alerts, want 1", len(alerts))
+	}
+	if alert := alerts[0].(DeepReorgEvent); alert.CommonBlock != (core.Hash{2}) || alert.Dropped != 5 || alert.Added != 6 || alert.Threshold != 3 {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+
+	service := new(ClassicService)
+	status, err := service.ReorgStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Degraded || status.Last == nil || status.Last.Dropped != 5 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	cleared, err := new(ClassicAdminService).ClearReorgAlert(context.Background())
+	if err != nil || !cleared {
+		t.Fatalf("ClearReorgAlert = %v, %v, want true", cleared, err)
+	}
+	if status, _ := service.ReorgStatus(context.Background()); status.Degraded {
+		t.Error("node still degraded after clearing the alert")
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// replayState is a throwaway state overlay on top of a read-only account trie.
+// Balance changes are only recorded in memory, so replaying reward
+// accumulation against it never touches canonical state.
+type replayState struct {
+	trie     core.Trie
+	balances map[core.Address]*big.Int
+}
+
+func newReplayState(trie core.Trie) *replayState {
+	return &replayState{trie: trie, balances: make(map[core.Address]*big.Int)}
+}
+
+func (s *replayState) account(addr core.Address) *core.StateAccount {
+	if s.trie == nil {
+		return nil
+	}
+	account, err := s.trie.GetAccount(addr)
+	if err != nil {
+		return nil
+	}
+	return account
+}
+
+func (s *replayState) GetBalance(addr core.Address) *big.Int {
+	if balance, ok := s.balances[addr]; ok {
+		return new(big.Int).Set(balance)
+	}
+	if account := s.account(addr); account != nil && account.Balance != nil {
+		return new(big.Int).Set(account.Balance)
+	}
+	return new(big.Int)
+}
+
+func (s *replayState) AddBalance(addr core.Address, amount *big.Int) {
+	s.balances[addr] = new(big.Int).Add(s.GetBalance(addr), amount)
+}
+
+func (s *replayState) GetNonce(addr core.Address) uint64 {
+	if account := s.account(addr); account != nil {
+		return account.Nonce
+	}
+	return 0
+}
+
+func (s *replayState) GetCodeHash(addr core.Address) core.Hash {
+	if account := s.account(addr); account != nil {
+		return core.BytesToHash(account.CodeHash)
+	}
+	return core.Hash{}
+}
+
+func (s *replayState) GetCode(core.Address) []byte                         { return nil }
+func (s *replayState) GetCodeSize(core.Address) int                        { return 0 }
+func (s *replayState) GetRefund() uint64                                   { return 0 }
+func (s *replayState) GetCommittedState(core.Address, core.Hash) core.Hash { return core.Hash{} }
+func (s *replayState) GetState(core.Address, core.Hash) core.Hash          { return core.Hash{} }
+func (s *replayState) HasSuicided(core.Address) bool                       { return false }
+func (s *replayState) Exist(addr core.Address) bool                        { return s.account(addr) != nil }
+func (s *replayState) Empty(addr core.Address) bool {
+	return s.GetNonce(addr) == 0 && s.GetBalance(addr).Sign() == 0 && s.GetCodeHash(addr) == (core.Hash{})
+}
+func (s *replayState) AddressInAccessList(core.Address) bool { return false }
+func (s *replayState) SlotInAccessList(core.Address, core.Hash) (bool, bool) {
+	return false, false
+}
+func (s *replayState) IntermediateRoot(bool) core.Hash { return core.Hash{} }
+
+// BalanceDelta compares the replayed reward of an account with the balance
+// change recorded by the canonical block.
+type BalanceDelta struct {
+	Address  core.Address `json:"address"`
+	Expected *hexutil.Big `json:"expected"`
+	Actual   *hexutil.Big `json:"actual"`
+	Match    bool         `json:"match"`
+}
+
+// ReplayResult is the outcome of replaying the reward accumulation of a block.
+type ReplayResult struct {
+	Number *hexutil.Big    `json:"number"`
+	Hash   core.Hash       `json:"hash"`
+	Fees   *hexutil.Big    `json:"fees"`
+	Deltas []*BalanceDelta `json:"deltas"`
+	Match  bool            `json:"match"`
+}
+
+// replayRewards accumulates the block rewards on top of the parent state and
+// compares the resulting balance changes with those of the post state. The
+// coinbase is additionally credited with the transaction fees of the block.
+func replayRewards(config *PluginConfigurator, parent, post core.Trie, header *types.Header, uncles []*types.Header, fees *big.Int) *ReplayResult {
+	state := newReplayState(parent)
+	AccumulateRewards(config, state, header, uncles)
+
+	result := &ReplayResult{
+		Number: (*hexutil.Big)(header.Number),
+		Hash:   header.Hash(),
+		Fees:   (*hexutil.Big)(fees),
+		Match:  true,
+	}
+	addrs := []core.Address{header.Coinbase}
+	for _, uncle := range uncles {
+		addrs = append(addrs, uncle.Coinbase)
+	}
+	var (
+		base      = newReplayState(parent)
+		seen      = make(map[core.Address]bool)
+		canonical = newReplayState(post)
+	)
+	for _, addr := range addrs {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		expected := new(big.Int).Sub(state.GetBalance(addr), base.GetBalance(addr))
+		actual := new(big.Int).Sub(canonical.GetBalance(addr), base.GetBalance(addr))
+		want := new(big.Int).Set(expected)
+		if addr == header.Coinbase {
+			want.Add(want, fees)
+		}
+		delta := &BalanceDelta{
+			Address:  addr,
+			Expected: (*hexutil.Big)(expected),
+			Actual:   (*hexutil.Big)(actual),
+			Match:    want.Cmp(actual) == 0,
+		}
+		result.Match = result.Match && delta.Match
+		result.Deltas = append(result.Deltas, delta)
+	}
+	return result
+}
+
+// blockFees sums the fees paid by the transactions of a block. Ethereum
+// Classic has no base fee, so the full gas price goes to the coinbase.
+func (service *ClassicService) blockFees(ctx context.Context, block *types.Block) (*big.Int, error) {
+	fees := new(big.Int)
+	if len(block.Transactions()) == 0 {
+		return fees, nil
+	}
+	data, err := service.backend.GetReceipts(ctx, block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	var receipts []struct {
+		GasUsed hexutil.Uint64 `json:"gasUsed"`
+	}
+	if err := json.Unmarshal(data, &receipts); err != nil {
+		return nil, err
+	}
+	for i, tx := range block.Transactions() {
+		if i >= len(receipts) {
+			break
+		}
+		fee := new(big.Int).SetUint64(uint64(receipts[i].GasUsed))
+		fees.Add(fees, fee.Mul(fee, tx.GasPrice()))
+	}
+	return fees, nil
+}
+
+// ReplayRewards replays the reward accumulation of the given block against a
+// copy of its parent state and reports whether the resulting balance changes
+// match the canonical block. Canonical state is never modified. Balance
+// changes caused by transactions other than fees, such as transfers to or from
+// the coinbase, show up as mismatches.
+func (service *ClassicService) ReplayRewards(ctx context.Context, blockNr restricted.BlockNumber) (*ReplayResult, error) {
+	release, err := heavyRPCs.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	block, err := service.blockByNumber(ctx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	return service.replayBlock(ctx, block)
+}
+
+// blockByNumber decodes the block with the given number as reported by the
+// backend.
+func (service *ClassicService) blockByNumber(ctx context.Context, blockNr restricted.BlockNumber) (*types.Block, error) {
+	data, err := service.backend.BlockByNumber(ctx, int64(blockNr))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errUnknownBlock
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(data, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// replayBlock replays the reward accumulation of the block, see ReplayRewards.
+func (service *ClassicService) replayBlock(ctx context.Context, block *types.Block) (*ReplayResult, error) {
+	header := block.Header()
+	data, err := service.backend.HeaderByHash(ctx, header.ParentHash)
+	if err != nil {
+		return nil, err
+	}
+	parent := new(types.Header)
+	if err := rlp.DecodeBytes(data, parent); err != nil {
+		return nil, err
+	}
+	parentTrie, err := service.backend.GetTrie(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	postTrie, err := service.backend.GetTrie(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	fees, err := service.blockFees(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	return replayRewards(NewPluginConfig(), parentTrie, postTrie, header, block.Uncles(), fees), nil
+}
+
+// RewardCheckResult compares the expected reward of the head block's coinbase
+// with its observed balance change. Fees, Actual and Match are only set if the
+// state needed to observe the balance change is available.
+type RewardCheckResult struct {
+	Number       *hexutil.Big `json:"number"`
+	Hash         core.Hash    `json:"hash"`
+	Coinbase     core.Address `json:"miner"`
+	Expected     *hexutil.Big `json:"expected"`
+	Fees         *hexutil.Big `json:"fees,omitempty"`
+	Actual       *hexutil.Big `json:"actual,omitempty"`
+	Determinable bool         `json:"determinable"`
+	Match        bool         `json:"match"`
+}
+
+// LatestRewardCheck compares the expected reward of the head block with the
+// balance change of its coinbase, as a lightweight continuous integrity
+// check. The balance change is expected to equal the reward plus the
+// transaction fees of the block.
+func (service *ClassicService) LatestRewardCheck(ctx context.Context) (*RewardCheckResult, error) {
+	release, err := heavyRPCs.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	block, err := service.blockByNumber(ctx, restricted.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	header := block.Header()
+	expected, _ := cachedRewards(NewPluginConfig(), header, block.Uncles())
+	result := &RewardCheckResult{
+		Number:   (*hexutil.Big)(header.Number),
+		Hash:     header.Hash(),
+		Coinbase: header.Coinbase,
+		Expected: (*hexutil.Big)(expected),
+	}
+	replay, err := service.replayBlock(ctx, block)
+	if err != nil {
+		// Without the parent and head state the balance change is unknown.
+		log.Debug("Unable to determine head reward balance change", "number", header.Number, "err", err)
+		return result, nil
+	}
+	for _, delta := range replay.Deltas {
+		if delta.Address == header.Coinbase {
+			result.Fees = replay.Fees
+			result.Actual = delta.Actual
+			result.Match = delta.Match
+			result.Determinable = true
+		}
+	}
+	return result, nil
+}
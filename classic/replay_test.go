@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// testTrie serves accounts from memory. Trie methods it does not override
+// panic, the embedded interface being nil.
+type testTrie struct {
+	core.Trie
+	accounts map[core.Address]*core.StateAccount
+}
+
+func (t *testTrie) GetAccount(addr core.Address) (*core.StateAccount, error) {
+	return t.accounts[addr], nil
+}
+
+// newTestTrie returns a trie holding accounts with the given balances.
+func newTestTrie(balances map[core.Address]*big.Int) *testTrie {
+	trie := &testTrie{accounts: make(map[core.Address]*core.StateAccount)}
+	for addr, balance := range balances {
+		trie.accounts[addr] = &core.StateAccount{Balance: balance}
+	}
+	return trie
+}
+
+func TestReplayRewards(t *testing.T) {
+	var (
+		miner  = core.Address{1}
+		uncle  = core.Address{2}
+		header = &types.Header{Number: big.NewInt(4_000_000), Coinbase: miner}
+		uncles = []*types.Header{{Number: big.NewInt(3_999_999), Coinbase: uncle}}
+		fees   = etc(0.01)
+		parent = newTestTrie(map[core.Address]*big.Int{miner: etc(10)})
+	)
+	tests := []struct {
+		name  string
+		post  map[core.Address]*big.Int
+		match bool
+	}{
+		// Miner: 5 ETC, 5/32 ETC for the uncle and the fees. Uncle: 7/8 of 5 ETC.
+		{"canonical", map[core.Address]*big.Int{miner: etc(15.16625), uncle: etc(4.375)}, true},
+		{"missing fees", map[core.Address]*big.Int{miner: etc(15.15625), uncle: etc(4.375)}, false},
+		{"unrewarded uncle", map[core.Address]*big.Int{miner: etc(15.16625)}, false},
+	}
+	for _, tt := range tests {
+		result := replayRewards(NewPluginConfig(), parent, newTestTrie(tt.post), header, uncles, fees)
+		if result.Match != tt.match {
+			t.Errorf("%s: match %v, want %v", tt.name, result.Match, tt.match)
+		}
+		if len(result.Deltas) != 2 {
+			t.Fatalf("%s: %d deltas, want 2", tt.name, len(result.Deltas))
+		}
+		if expected := result.Deltas[0].Expected.ToInt(); expected.Cmp(etc(5.15625)) != 0 {
+			t.Errorf("%s: expected miner reward %v, want 5.15625 ETC", tt.name, expected)
+		}
+		if expected := result.Deltas[1].Expected.ToInt(); expected.Cmp(etc(4.375)) != 0 {
+			t.Errorf("%s: expected uncle reward %v, want 4.375 ETC", tt.name, expected)
+		}
+	}
+	// Replaying must leave the parent state untouched.
+	if balance := parent.accounts[miner].Balance; balance.Cmp(etc(10)) != 0 {
+		t.Errorf("parent miner balance changed to %v", balance)
+	}
+	if _, ok := parent.accounts[uncle]; ok {
+		t.Error("uncle account created in the parent state")
+	}
+}
+
+// testStateBackend serves a head block, its parent header and the account
+// tries of both. Backend methods it does not override panic, the embedded
+// interface being nil.
+type testStateBackend struct {
+	core.Backend
+	head   *types.Block
+	parent *types.Header
+	tries  map[core.Hash]core.Trie
+}
+
+func (b *testStateBackend) BlockByNumber(ctx context.Context, number int64) ([]byte, error) {
+	return rlp.EncodeToBytes(b.head)
+}
+
+func (b *testStateBackend) HeaderByHash(ctx context.Context, hash core.Hash) ([]byte, error) {
+	return rlp.EncodeToBytes(b.parent)
+}
+
+func (b *testStateBackend) GetTrie(root core.Hash) (core.Trie, error) {
+	if trie, ok := b.tries[root]; ok {
+		return trie, nil
+	}
+	return nil, errors.New("missing trie")
+}
+
+func TestLatestRewardCheck(t *testing.T) {
+	var (
+		miner  = core.Address{1}
+		parent = &types.Header{Number: big.NewInt(3_999_999), Root: core.Hash{1}}
+		header = &types.Header{Number: big.NewInt(4_000_000), Coinbase: miner, ParentHash: parent.Hash(), Root: core.Hash{2}}
+		uncles = []*types.Header{{Number: big.NewInt(3_999_999), Coinbase: core.Address{2}}}
+		head   = types.NewBlock(header, nil, uncles, nil, nil)
+	)
+	tests := []struct {
+		name         string
+		post         map[core.Address]*big.Int
+		determinable bool
+		match        bool
+	}{
+		// Miner: 5 ETC and 5/32 ETC for the uncle
+		{"canonical", map[core.Address]*big.Int{miner: etc(15.15625), uncles[0].Coinbase: etc(4.375)}, true, true},
+		{"diverged", map[core.Address]*big.Int{miner: etc(15)}, true, false},
+		{"pruned", nil, false, false},
+	}
+	for _, tt := range tests {
+		tries := map[core.Hash]core.Trie{parent.Root: newTestTrie(map[core.Address]*big.Int{miner: etc(10)})}
+		if tt.post != nil {
+			tries[header.Root] = newTestTrie(tt.post)
+		}
+		service := &ClassicService{backend: &testStateBackend{head: head, parent: parent, tries: tries}}
+
+		result, err := service.LatestRewardCheck(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.Number.ToInt().Cmp(header.Number) != 0 || result.Coinbase != miner || result.Expected.ToInt().Cmp(etc(5.15625)) != 0 {
+			t.Errorf("%s: checked block %v mined by %x expecting %v, want block %v mined by %x expecting 5.15625 ETC", tt.name, result.Number, result.Coinbase, result.Expected, header.Number, miner)
+		}
+		if result.Determinable != tt.determinable || result.Match != tt.match {
+			t.Errorf("%s: determinable %v, match %v, want %v, %v", tt.name, result.Determinable, result.Match, tt.determinable, tt.match)
+		}
+	}
+}
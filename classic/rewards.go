@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"math/big"
+	"sort"
 
 	"github.com/openrelayxyz/plugeth-utils/core"
 	"github.com/openrelayxyz/plugeth-utils/restricted/types"
@@ -28,6 +32,10 @@ func GetRewards(config *PluginConfigurator, header *types.Header, uncles []*type
 	reward := new(big.Int).Set(blockReward)
 	r := new(big.Int)
 	for i, uncle := range uncles {
+		if !wellFormedUncle(uncle) {
+			uncleRewards[i] = new(big.Int)
+			continue
+		}
 		r.Add(uncle.Number, big8)
 		r.Sub(r, header.Number)
 		r.Mul(r, blockReward)
@@ -43,11 +51,71 @@ func GetRewards(config *PluginConfigurator, header *types.Header, uncles []*type
 	return reward, uncleRewards
 }
 
+var errMalformedHeader = errors.New("header without a block number")
+
+// GetRewardsForRange returns the miner reward of each of the given contiguous
+// headers, as GetRewards would, looking the uncles of each block up by number.
+// The ECIP-1017 era and its rewards are only computed once per era.
+func GetRewardsForRange(config *PluginConfigurator, headers []*types.Header, unclesByBlock map[uint64][]*types.Header) ([]*big.Int, error) {
+	var (
+		eraLength = *config.GetEthashECIP1017EraRounds()
+		schedule  = config.GetEthashECIP1017EraRoundsSchedule()
+
+		eraEnd         uint64   // First block past the era the rewards below belong to
+		winnerReward   *big.Int // Winner reward of the current era
+		inclusionBonus *big.Int // Winner reward per included uncle in the current era
+	)
+	rewards := make([]*big.Int, len(headers))
+	for i, header := range headers {
+		if header == nil || header.Number == nil {
+			return nil, errMalformedHeader
+		}
+		number := header.Number.Uint64()
+		if i > 0 && number != headers[i-1].Number.Uint64()+1 {
+			return nil, fmt.Errorf("headers not contiguous: block %d follows %d", number, headers[i-1].Number.Uint64())
+		}
+		uncles := unclesByBlock[number]
+		if !config.IsEnabled(config.GetEthashECIP1017Transition, header.Number) {
+			rewards[i], _ = GetRewards(config, header, uncles)
+			continue
+		}
+		if winnerReward == nil || number >= eraEnd {
+			era := GetBlockEraBySchedule(header.Number, new(big.Int).SetUint64(eraLength), schedule)
+			eraEnd = nextEraBlock(number, eraLength, schedule)
+			winnerReward = GetBlockWinnerRewardByEra(era, FrontierBlockReward)
+			inclusionBonus = getEraUncleBlockReward(era, FrontierBlockReward)
+		}
+		reward := new(big.Int).Set(winnerReward)
+		for _, uncle := range uncles {
+			if wellFormedUncle(uncle) {
+				reward.Add(reward, inclusionBonus)
+			}
+		}
+		rewards[i] = reward
+	}
+	return rewards, nil
+}
+
+// wellFormedUncle reports whether an uncle header can be rewarded. Nil uncles
+// and uncles without a number are skipped by the reward calculation, earning
+// neither themselves nor the including miner anything, instead of panicking.
+func wellFormedUncle(uncle *types.Header) bool {
+	return uncle != nil && uncle.Number != nil
+}
+
 // AccumulateRewards credits the coinbase of the given block with the mining
-// reward. The coinbase of each uncle block is also rewarded.
+// reward. The coinbase of each uncle block is also rewarded. A nil or empty
+// uncle list only credits the miner. Blocks of chains not sealed by ethash,
+// such as the Clique sealed Kotti, earn no reward.
 func AccumulateRewards(config *PluginConfigurator, state core.RWStateDB, header *types.Header, uncles []*types.Header) {
+	if config != nil && !config.GetConsensusEngineType().IsEthash() {
+		return
+	}
 	minerReward, uncleRewards := GetRewards(config, header, uncles)
 	for i, uncle := range uncles {
+		if !wellFormedUncle(uncle) {
+			continue
+		}
 		state.AddBalance(uncle.Coinbase, uncleRewards[i])
 	}
 	state.AddBalance(header.Coinbase, minerReward)
@@ -111,15 +179,28 @@ func ecip1017BlockReward(config *PluginConfigurator, header *types.Header, uncle
 	blockReward := FrontierBlockReward
 
 	// Ensure value 'era' is configured.
-	eraLen := config.GetEthashECIP1017EraRounds()
-	era := GetBlockEra(header.Number, new(big.Int).SetUint64(*eraLen))
-	wr := GetBlockWinnerRewardByEra(era, blockReward)                    // wr "winner reward". 5, 4, 3.2, 2.56, ...
-	wurs := GetBlockWinnerRewardForUnclesByEra(era, uncles, blockReward) // wurs "winner uncle rewards"
+	eraLen := new(big.Int)
+	if rounds := config.GetEthashECIP1017EraRounds(); rounds != nil {
+		eraLen.SetUint64(*rounds)
+	}
+	era := GetBlockEraBySchedule(header.Number, eraLen, config.GetEthashECIP1017EraRoundsSchedule())
+	rewarded := make([]*types.Header, 0, len(uncles))
+	for _, uncle := range uncles {
+		if wellFormedUncle(uncle) {
+			rewarded = append(rewarded, uncle)
+		}
+	}
+	wr := GetBlockWinnerRewardByEra(era, blockReward)                      // wr "winner reward". 5, 4, 3.2, 2.56, ...
+	wurs := GetBlockWinnerRewardForUnclesByEra(era, rewarded, blockReward) // wurs "winner uncle rewards"
 	wr.Add(wr, wurs)
 
 	// Reward uncle miners.
 	uncleRewards := make([]*big.Int, len(uncles))
 	for i, uncle := range uncles {
+		if !wellFormedUncle(uncle) {
+			uncleRewards[i] = new(big.Int)
+			continue
+		}
 		ur := GetBlockUncleRewardByEra(era, header, uncle, blockReward)
 		uncleRewards[i] = ur
 	}
@@ -134,6 +215,11 @@ func GetBlockEra(blockNum, eraLength *big.Int) *big.Int {
 	if blockNum.Sign() < 1 {
 		return new(big.Int)
 	}
+	// Without a positive era length there are no era boundaries, everything
+	// stays in the first era.
+	if eraLength == nil || eraLength.Sign() < 1 {
+		return new(big.Int)
+	}
 
 	remainder := big.NewInt(0).Mod(big.NewInt(0).Sub(blockNum, big.NewInt(1)), eraLength)
 	base := big.NewInt(0).Sub(blockNum, remainder)
@@ -144,6 +230,96 @@ func GetBlockEra(blockNum, eraLength *big.Int) *big.Int {
 	return new(big.Int).Sub(d, dremainder)
 }
 
+// GetBlockEraBySchedule is GetBlockEra for chains whose era length changes
+// over time. The schedule maps activation blocks to the era length in use from
+// that block on; each activation starts a new era. eraLength applies before
+// the first activation. With an empty schedule it equals GetBlockEra.
+func GetBlockEraBySchedule(blockNum, eraLength *big.Int, schedule Uint64BigMapEncodesHex) *big.Int {
+	if len(schedule) == 0 || blockNum.Sign() < 1 {
+		return GetBlockEra(blockNum, eraLength)
+	}
+	var (
+		offset = new(big.Int)
+		start  = big.NewInt(1)
+		length = eraLength
+	)
+	for _, activation := range scheduleActivations(schedule) {
+		a := new(big.Int).SetUint64(activation)
+		if a.Cmp(start) <= 0 {
+			// An activation at or before the first block only replaces the
+			// base era length.
+			length = schedule[activation]
+			continue
+		}
+		if a.Cmp(blockNum) > 0 {
+			break
+		}
+		// Count the eras started in [start, activation), the last one is cut
+		// short by the activation.
+		span := new(big.Int).Sub(a, start)
+		offset.Add(offset, GetBlockEra(span, length))
+		offset.Add(offset, big1)
+
+		start, length = a, schedule[activation]
+	}
+	relative := new(big.Int).Sub(blockNum, start)
+	relative.Add(relative, big1)
+	return offset.Add(offset, GetBlockEra(relative, length))
+}
+
+// scheduleActivations returns the activation blocks of an era length schedule
+// in ascending order.
+func scheduleActivations(schedule Uint64BigMapEncodesHex) []uint64 {
+	activations := make([]uint64, 0, len(schedule))
+	for activation := range schedule {
+		activations = append(activations, activation)
+	}
+	sort.Slice(activations, func(i, j int) bool { return activations[i] < activations[j] })
+	return activations
+}
+
+// EraStartBlock returns the first block of the given zero-indexed ECIP-1017
+// era under the configured era length schedule. The first era starts at block
+// 1 by convention, although GetBlockEra also maps the genesis block to it.
+func EraStartBlock(era uint64) uint64 {
+	config := NewPluginConfig()
+	return eraStartBlock(era, *config.GetEthashECIP1017EraRounds(), config.GetEthashECIP1017EraRoundsSchedule())
+}
+
+// eraStartBlock is the inverse of GetBlockEraBySchedule, returning the first
+// block of the given era. It returns math.MaxUint64 for eras that are never
+// reached, because a zero era length never ends the era before them or their
+// start does not fit a uint64.
+func eraStartBlock(era, eraLength uint64, schedule Uint64BigMapEncodesHex) uint64 {
+	var (
+		offset uint64
+		start  = uint64(1)
+		length = eraLength
+	)
+	for _, activation := range scheduleActivations(schedule) {
+		if activation <= start {
+			length = schedule[activation].Uint64()
+			continue
+		}
+		eras := uint64(1)
+		if length > 0 {
+			eras = (activation-start-1)/length + 1
+		}
+		if era < offset+eras {
+			break
+		}
+		offset += eras
+		start, length = activation, schedule[activation].Uint64()
+	}
+	if era == offset {
+		return start
+	}
+	if length == 0 || era-offset > (math.MaxUint64-start)/length {
+		return math.MaxUint64
+	}
+	return start + (era-offset)*length
+}
+
 func EthashBlockReward(c *PluginConfigurator, n *big.Int) *big.Int {
 	// Select the correct block reward based on chain progression
 	blockReward := FrontierBlockReward
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// maxUncleDepth is the number of ancestors an uncle may branch off from, as
+// enforced by VerifyUncles.
+const maxUncleDepth = 7
+
+// rewardCacheSize is the number of reward computations memoized by
+// newRewardResult.
+const rewardCacheSize = 1024
+
+var (
+	errInvalidUncleNumber = errors.New("uncle number out of range")
+	errInvalidKeepRecent  = errors.New("keepRecent must not be negative")
+	errInvalidEraCount    = fmt.Errorf("eras must be between 1 and %d", maxScheduleEras)
+
+	// errEraOutOfRange is returned for eras past the schedule. The winner
+	// reward is zero long before, but computing it takes memory growing with
+	// the era.
+	errEraOutOfRange = fmt.Errorf("era must be below %d", maxScheduleEras-1)
+)
+
+// maxScheduleEras bounds the number of eras a schedule RPC may return.
+const maxScheduleEras = 1024
+
+// rewardKey identifies a reward computation by the block and the exact set of
+// uncles it was computed for.
+type rewardKey struct {
+	header core.Hash
+	uncles core.Hash
+}
+
+// rewardEntry is a memoized reward computation.
+type rewardEntry struct {
+	miner  *big.Int
+	uncles []*big.Int
+}
+
+var rewardCache = NewCache[rewardKey, *rewardEntry](rewardCacheSize)
+
+// cachedRewards is GetRewards memoized by block and uncle hash.
+func cachedRewards(config *PluginConfigurator, header *types.Header, uncles []*types.Header) (*big.Int, []*big.Int) {
+	key := rewardKey{header.Hash(), types.CalcUncleHash(uncles)}
+	entry, ok := rewardCache.Get(key)
+	if !ok {
+		entry = new(rewardEntry)
+		entry.miner, entry.uncles = GetRewards(config, header, uncles)
+		rewardCache.Add(key, entry)
+	}
+	uncleRewards := make([]*big.Int, len(entry.uncles))
+	for i, reward := range entry.uncles {
+		uncleRewards[i] = new(big.Int).Set(reward)
+	}
+	return new(big.Int).Set(entry.miner), uncleRewards
+}
+
+// EraDeltaResult describes the winner reward change between an ECIP-1017 era
+// and the one following it.
+type EraDeltaResult struct {
+	Era             uint64       `json:"era"`
+	Reward          *hexutil.Big `json:"reward"`
+	NextReward      *hexutil.Big `json:"nextReward"`
+	Decrease        *hexutil.Big `json:"decrease"`
+	DecreasePercent float64      `json:"decreasePercent"`
+
+	// Populated when a unit is requested.
+	Unit             string `json:"unit,omitempty"`
+	RewardInUnit     string `json:"rewardInUnit,omitempty"`
+	NextRewardInUnit string `json:"nextRewardInUnit,omitempty"`
+	DecreaseInUnit   string `json:"decreaseInUnit,omitempty"`
+}
+
+// EraRewardDelta returns the winner reward of the given zero-indexed era and
+// the next one, along with the absolute and relative decrease between them.
+// If unit is given, the amounts are additionally rendered in that unit.
+func (service *ClassicService) EraRewardDelta(ctx context.Context, era uint64, unit *string) (*EraDeltaResult, error) {
+	if era >= maxScheduleEras-1 {
+		return nil, errEraOutOfRange
+	}
+	current := GetBlockWinnerRewardByEra(new(big.Int).SetUint64(era), FrontierBlockReward)
+	next := GetBlockWinnerRewardByEra(new(big.Int).SetUint64(era+1), FrontierBlockReward)
+	decrease := new(big.Int).Sub(current, next)
+
+	var percent float64
+	if current.Sign() > 0 {
+		ratio := new(big.Float).Quo(new(big.Float).SetInt(decrease), new(big.Float).SetInt(current))
+		percent, _ = ratio.Mul(ratio, big.NewFloat(100)).Float64()
+	}
+	result := &EraDeltaResult{
+		Era:             era,
+		Reward:          (*hexutil.Big)(current),
+		NextReward:      (*hexutil.Big)(next),
+		Decrease:        (*hexutil.Big)(decrease),
+		DecreasePercent: percent,
+	}
+	if unit != nil {
+		var err error
+		result.Unit = *unit
+		if result.RewardInUnit, err = formatWei(current, *unit); err != nil {
+			return nil, err
+		}
+		result.NextRewardInUnit, _ = formatWei(next, *unit)
+		result.DecreaseInUnit, _ = formatWei(decrease, *unit)
+	}
+	return result, nil
+}
+
+// UncleReward is the reward credited to the coinbase of a single uncle.
+type UncleReward struct {
+	Number   *hexutil.Big `json:"number"`
+	Coinbase core.Address `json:"miner"`
+	Reward   *hexutil.Big `json:"reward"`
+
+	RewardInUnit string `json:"rewardInUnit,omitempty"`
+}
+
+// RewardResult is the reward breakdown of a block: the amount credited to the
+// block's coinbase (including the uncle inclusion bonus) and to each uncle.
+type RewardResult struct {
+	Number       *hexutil.Big   `json:"number"`
+	Coinbase     core.Address   `json:"miner"`
+	MinerReward  *hexutil.Big   `json:"minerReward"`
+	UncleRewards []*UncleReward `json:"uncleRewards"`
+
+	// Populated when a unit is requested.
+	Unit              string `json:"unit,omitempty"`
+	MinerRewardInUnit string `json:"minerRewardInUnit,omitempty"`
+}
+
+// setUnit renders the reward amounts in the given unit, if any.
+func (result *RewardResult) setUnit(unit *string) error {
+	if unit == nil {
+		return nil
+	}
+	var err error
+	result.Unit = *unit
+	if result.MinerRewardInUnit, err = formatWei(result.MinerReward.ToInt(), *unit); err != nil {
+		return err
+	}
+	for _, uncle := range result.UncleRewards {
+		uncle.RewardInUnit, _ = formatWei(uncle.Reward.ToInt(), *unit)
+	}
+	return nil
+}
+
+// newRewardResult computes the rewards for the header and its uncles.
+func newRewardResult(config *PluginConfigurator, header *types.Header, uncles []*types.Header) *RewardResult {
+	minerReward, uncleRewards := cachedRewards(config, header, uncles)
+	result := &RewardResult{
+		Number:       (*hexutil.Big)(header.Number),
+		Coinbase:     header.Coinbase,
+		MinerReward:  (*hexutil.Big)(minerReward),
+		UncleRewards: make([]*UncleReward, len(uncles)),
+	}
+	for i, uncle := range uncles {
+		result.UncleRewards[i] = &UncleReward{
+			Number:   (*hexutil.Big)(uncle.Number),
+			Coinbase: uncle.Coinbase,
+			Reward:   (*hexutil.Big)(uncleRewards[i]),
+		}
+	}
+	return result
+}
+
+// validateUncleNumbers checks that the uncles are within the depth an ethash
+// block may reference, so that the reward formulas stay meaningful.
+func validateUncleNumbers(header *types.Header, uncles []*types.Header) error {
+	if len(uncles) > maxUncles {
+		return errTooManyUncles
+	}
+	for _, uncle := range uncles {
+		depth := new(big.Int).Sub(header.Number, uncle.Number)
+		if depth.Sign() <= 0 || depth.Cmp(big.NewInt(maxUncleDepth)) > 0 {
+			return fmt.Errorf("%w: uncle %v for block %v", errInvalidUncleNumber, uncle.Number, header.Number)
+		}
+	}
+	return nil
+}
+
+// RewardFromHeader computes the rewards of a block purely from the supplied
+// header and uncle headers, without consulting the local chain. This allows
+// light clients to compute rewards from data they already hold. If unit is
+// given, the amounts are additionally rendered in that unit.
+func (service *ClassicService) RewardFromHeader(ctx context.Context, header HeaderSpec, uncleHeaders []HeaderSpec, unit *string) (*RewardResult, error) {
+	h, err := header.toHeader()
+	if err != nil {
+		return nil, err
+	}
+	config := NewPluginConfig()
+	if err := checkRewardEra(config, h.Number); err != nil {
+		return nil, err
+	}
+	uncles := make([]*types.Header, len(uncleHeaders))
+	for i := range uncleHeaders {
+		if uncles[i], err = uncleHeaders[i].toHeader(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateUncleNumbers(h, uncles); err != nil {
+		return nil, err
+	}
+	result := newRewardResult(config, h, uncles)
+	if err := result.setUnit(unit); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TrimRewardCache evicts all but the keepRecent most recently used entries of
+// the reward cache and returns the number of entries removed.
+func (service *RewardCacheService) TrimRewardCache(ctx context.Context, keepRecent int) (int, error) {
+	if keepRecent < 0 {
+		return 0, errInvalidKeepRecent
+	}
+	return rewardCache.Trim(keepRecent), nil
+}
+
+// UncleRewardInfo is the reward credited to an uncle's coinbase in an era.
+// In the first era (index 0) the reward depends on the distance between the
+// uncle and the including block, so Reward is omitted and ByDistance lists the
+// reward for distances 1 through 7 instead. Later eras pay a flat 1/32 of the
+// era's winner reward.
+type UncleRewardInfo struct {
+	Era           uint64         `json:"era"`
+	DistanceBased bool           `json:"distanceBased"`
+	Reward        *hexutil.Big   `json:"reward,omitempty"`
+	ByDistance    []*hexutil.Big `json:"byDistance,omitempty"`
+}
+
+// UncleRewardSchedule returns the uncle reward of the first eras eras.
+func (service *ClassicService) UncleRewardSchedule(ctx context.Context, eras int) ([]UncleRewardInfo, error) {
+	if eras < 1 || eras > maxScheduleEras {
+		return nil, errInvalidEraCount
+	}
+	schedule := make([]UncleRewardInfo, eras)
+	for i := range schedule {
+		era := big.NewInt(int64(i))
+		schedule[i].Era = uint64(i)
+		if i == 0 {
+			schedule[i].DistanceBased = true
+			for distance := int64(1); distance <= maxUncleDepth; distance++ {
+				header := &types.Header{Number: big.NewInt(distance)}
+				uncle := &types.Header{Number: new(big.Int)}
+				reward := GetBlockUncleRewardByEra(era, header, uncle, FrontierBlockReward)
+				schedule[i].ByDistance = append(schedule[i].ByDistance, (*hexutil.Big)(reward))
+			}
+			continue
+		}
+		schedule[i].Reward = (*hexutil.Big)(getEraUncleBlockReward(era, FrontierBlockReward))
+	}
+	return schedule, nil
+}
+
+// EraInfo describes the block range of an ECIP-1017 era and the winner reward
+// paid within it.
+type EraInfo struct {
+	Era        uint64       `json:"era"`
+	StartBlock uint64       `json:"startBlock"`
+	EndBlock   uint64       `json:"endBlock"`
+	Reward     *hexutil.Big `json:"reward"`
+}
+
+// ECIP1017Schedule returns the block ranges and winner rewards of the first
+// eras eras. The genesis block belongs to the first era as well.
+func (service *ClassicService) ECIP1017Schedule(ctx context.Context, eras int) ([]EraInfo, error) {
+	if eras < 1 || eras > maxScheduleEras {
+		return nil, errInvalidEraCount
+	}
+	config := NewPluginConfig()
+	eraLength, schedule := *config.GetEthashECIP1017EraRounds(), config.GetEthashECIP1017EraRoundsSchedule()
+	result := make([]EraInfo, eras)
+	for i := range result {
+		era := uint64(i)
+		result[i] = EraInfo{
+			Era:        era,
+			StartBlock: eraStartBlock(era, eraLength, schedule),
+			EndBlock:   eraStartBlock(era+1, eraLength, schedule),
+			Reward:     (*hexutil.Big)(GetBlockWinnerRewardByEra(new(big.Int).SetUint64(era), FrontierBlockReward)),
+		}
+		if result[i].EndBlock != math.MaxUint64 {
+			result[i].EndBlock--
+		}
+	}
+	return result, nil
+}
+
+// nextEraBlock returns the first block of the era following the one block
+// belongs to, honouring an era length schedule as GetBlockEraBySchedule does.
+// It returns math.MaxUint64 if that era is never reached.
+func nextEraBlock(block, eraLength uint64, schedule Uint64BigMapEncodesHex) uint64 {
+	start, length := uint64(1), eraLength
+	for _, activation := range scheduleActivations(schedule) {
+		if activation <= start {
+			length = schedule[activation].Uint64()
+			continue
+		}
+		if activation > block {
+			if boundary := eraBoundary(block, start, length); boundary < activation {
+				return boundary
+			}
+			return activation
+		}
+		start, length = activation, schedule[activation].Uint64()
+	}
+	return eraBoundary(block, start, length)
+}
+
+// eraBoundary returns the first block past the era of block, for eras of the
+// given length counted from start. It returns math.MaxUint64 if the era never
+// ends.
+func eraBoundary(block, start, length uint64) uint64 {
+	if block < start {
+		// The genesis block belongs to the first era.
+		block = start
+	}
+	if length == 0 {
+		return math.MaxUint64
+	}
+	eras := (block-start)/length + 1
+	if eras > (math.MaxUint64-start)/length {
+		return math.MaxUint64
+	}
+	return start + eras*length
+}
+
+// NextEraBlock returns the first block of the ECIP-1017 era following the one
+// the current head is in.
+func (service *ClassicService) NextEraBlock(ctx context.Context) (uint64, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return 0, err
+	}
+	config := NewPluginConfig()
+	return nextEraBlock(head.Number.Uint64(), *config.GetEthashECIP1017EraRounds(), config.GetEthashECIP1017EraRoundsSchedule()), nil
+}
+
+// EraForBlock returns the zero-indexed ECIP-1017 era of the given block,
+// resolving latest and pending against the current head.
+func (service *ClassicService) EraForBlock(ctx context.Context, blockNr restricted.BlockNumber) (uint64, error) {
+	var number *big.Int
+	if blockNr < 0 {
+		head, err := service.headHeader()
+		if err != nil {
+			return 0, err
+		}
+		number = head.Number
+	} else {
+		number = big.NewInt(int64(blockNr))
+	}
+	config := NewPluginConfig()
+	eraLength := new(big.Int).SetUint64(*config.GetEthashECIP1017EraRounds())
+	return GetBlockEraBySchedule(number, eraLength, config.GetEthashECIP1017EraRoundsSchedule()).Uint64(), nil
+}
+
+var errUnknownBlock = errors.New("unknown block")
+
+// GetBlockRewardByHash returns the reward breakdown of the block with the
+// given hash, which may be canonical or on a side chain. If unit is given, the
+// amounts are additionally rendered in that unit.
+func (service *ClassicService) GetBlockRewardByHash(ctx context.Context, hash core.Hash, unit *string) (*RewardResult, error) {
+	data, err := service.backend.BlockByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errUnknownBlock
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(data, block); err != nil {
+		return nil, err
+	}
+	result := newRewardResult(NewPluginConfig(), block.Header(), block.Uncles())
+	if err := result.setUnit(unit); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkRewardEra rejects caller supplied block numbers that do not fit in 64
+// bits or fall in an era past the schedule, see errEraOutOfRange.
+func checkRewardEra(config *PluginConfigurator, number *big.Int) error {
+	if !number.IsUint64() {
+		return errHeaderNumberRange
+	}
+	eraLength := new(big.Int).SetUint64(*config.GetEthashECIP1017EraRounds())
+	if era := GetBlockEraBySchedule(number, eraLength, config.GetEthashECIP1017EraRoundsSchedule()); era.Cmp(big.NewInt(maxScheduleEras-1)) >= 0 {
+		return errEraOutOfRange
+	}
+	return nil
+}
+
+// FutureBlockReward returns the reward of the block blocksAhead blocks after
+// the current head, assuming it includes no uncles. The coinbase of the
+// projected block is left empty.
+func (service *ClassicService) FutureBlockReward(ctx context.Context, blocksAhead uint64, unit *string) (*RewardResult, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return nil, err
+	}
+	config := NewPluginConfig()
+	number := new(big.Int).Add(head.Number, new(big.Int).SetUint64(blocksAhead))
+	if err := checkRewardEra(config, number); err != nil {
+		return nil, err
+	}
+	result := newRewardResult(config, &types.Header{Number: number}, nil)
+	if err := result.setUnit(unit); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MonetaryPolicyResult describes the ECIP-1017 emission schedule.
+type MonetaryPolicyResult struct {
+	ECIP1017Block      *uint64      `json:"ecip1017Block"`
+	EraLength          uint64       `json:"eraLength"`
+	DisinflationNum    *hexutil.Big `json:"disinflationRateNumerator"`
+	DisinflationDenom  *hexutil.Big `json:"disinflationRateDenominator"`
+	BaseReward         *hexutil.Big `json:"baseReward"`
+	CurrentEra         uint64       `json:"currentEra"`
+	CurrentEraReward   *hexutil.Big `json:"currentEraReward"`
+	UncleInclusionRate string       `json:"uncleInclusionRate"`
+}
+
+// MonetaryPolicy returns the parameters of Ethereum Classic's capped,
+// disinflationary emission: every era the winner reward is multiplied by the
+// disinflation rate.
+func (service *ClassicService) MonetaryPolicy(ctx context.Context) (*MonetaryPolicyResult, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return nil, err
+	}
+	config := NewPluginConfig()
+	eraLength := *config.GetEthashECIP1017EraRounds()
+	era := GetBlockEraBySchedule(head.Number, new(big.Int).SetUint64(eraLength), config.GetEthashECIP1017EraRoundsSchedule())
+	return &MonetaryPolicyResult{
+		ECIP1017Block:      config.GetEthashECIP1017Transition(),
+		EraLength:          eraLength,
+		DisinflationNum:    (*hexutil.Big)(new(big.Int).Set(DisinflationRateQuotient)),
+		DisinflationDenom:  (*hexutil.Big)(new(big.Int).Set(DisinflationRateDivisor)),
+		BaseReward:         (*hexutil.Big)(new(big.Int).Set(FrontierBlockReward)),
+		CurrentEra:         era.Uint64(),
+		CurrentEraReward:   (*hexutil.Big)(GetBlockWinnerRewardByEra(era, FrontierBlockReward)),
+		UncleInclusionRate: "1/32",
+	}, nil
+}
+
+// BlockRewardConstantsResult lists the block reward constants in use.
+type BlockRewardConstantsResult struct {
+	FrontierBlockReward      *hexutil.Big `json:"frontierBlockReward"`
+	EIP649FBlockReward       *hexutil.Big `json:"eip649BlockReward"`
+	EIP1234FBlockReward      *hexutil.Big `json:"eip1234BlockReward"`
+	DisinflationRateQuotient *hexutil.Big `json:"disinflationRateQuotient"`
+	DisinflationRateDivisor  *hexutil.Big `json:"disinflationRateDivisor"`
+}
+
+// BlockRewardConstants returns the block reward constants used by the node.
+// The EIP-649 and EIP-1234 rewards are listed for completeness, Ethereum
+// Classic never activated either reduction.
+func (service *ClassicService) BlockRewardConstants(ctx context.Context) (*BlockRewardConstantsResult, error) {
+	return &BlockRewardConstantsResult{
+		FrontierBlockReward:      (*hexutil.Big)(new(big.Int).Set(FrontierBlockReward)),
+		EIP649FBlockReward:       (*hexutil.Big)(new(big.Int).Set(EIP649FBlockReward)),
+		EIP1234FBlockReward:      (*hexutil.Big)(new(big.Int).Set(EIP1234FBlockReward)),
+		DisinflationRateQuotient: (*hexutil.Big)(new(big.Int).Set(DisinflationRateQuotient)),
+		DisinflationRateDivisor:  (*hexutil.Big)(new(big.Int).Set(DisinflationRateDivisor)),
+	}, nil
+}
+
+// BlockReward returns the reward breakdown of the canonical block with the
+// given number. If unit is given, the amounts are additionally rendered in
+// that unit.
+func (service *ClassicService) BlockReward(ctx context.Context, number restricted.BlockNumber, unit *string) (*RewardResult, error) {
+	block, err := service.blockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	result := newRewardResult(NewPluginConfig(), block.Header(), block.Uncles())
+	if err := result.setUnit(unit); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UncleInclusionResult is the part of a block's miner reward earned by
+// including uncles.
+type UncleInclusionResult struct {
+	Number   *hexutil.Big `json:"number"`
+	Uncles   int          `json:"uncles"`
+	ECIP1017 bool         `json:"ecip1017"`
+	Reward   *hexutil.Big `json:"reward"`
+}
+
+// UncleInclusionReward returns the bonus the miner of the given block earned
+// for including uncles: 1/32 of the block reward per uncle before ECIP-1017
+// and 1/32 of the era's winner reward per uncle after it.
+func (service *ClassicService) UncleInclusionReward(ctx context.Context, number restricted.BlockNumber) (*UncleInclusionResult, error) {
+	block, err := service.blockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	config := NewPluginConfig()
+	header := block.Header()
+	withUncles, _ := GetRewards(config, header, block.Uncles())
+	withoutUncles, _ := GetRewards(config, header, nil)
+	return &UncleInclusionResult{
+		Number:   (*hexutil.Big)(header.Number),
+		Uncles:   len(block.Uncles()),
+		ECIP1017: config.IsEnabled(config.GetEthashECIP1017Transition, header.Number),
+		Reward:   (*hexutil.Big)(withUncles.Sub(withUncles, withoutUncles)),
+	}, nil
+}
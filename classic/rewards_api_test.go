@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// etc converts an amount of ether into wei.
+func etc(ether float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(ether), big.NewFloat(1e18)).Int(nil)
+	return wei
+}
+
+func TestEraRewardDelta(t *testing.T) {
+	unit := "ether"
+	result, err := new(ClassicService).EraRewardDelta(context.Background(), 0, &unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reward.ToInt().Cmp(etc(5)) != 0 || result.NextReward.ToInt().Cmp(etc(4)) != 0 {
+		t.Errorf("rewards %v -> %v, want 5 -> 4 ETC", result.Reward, result.NextReward)
+	}
+	if result.Decrease.ToInt().Cmp(etc(1)) != 0 || result.DecreasePercent != 20 {
+		t.Errorf("decrease %v (%v%%), want 1 ETC (20%%)", result.Decrease, result.DecreasePercent)
+	}
+	if result.RewardInUnit != "5" || result.NextRewardInUnit != "4" || result.DecreaseInUnit != "1" {
+		t.Errorf("amounts in ether %q -> %q (%q)", result.RewardInUnit, result.NextRewardInUnit, result.DecreaseInUnit)
+	}
+	for _, era := range []uint64{maxScheduleEras - 1, 1e15, math.MaxUint64} {
+		if _, err := new(ClassicService).EraRewardDelta(context.Background(), era, nil); !errors.Is(err, errEraOutOfRange) {
+			t.Errorf("era %d: error %v, want %v", era, err, errEraOutOfRange)
+		}
+	}
+}
+
+func TestFutureBlockReward(t *testing.T) {
+	// Era 1 starts at block 5,000,001
+	service := testService(4999999)
+
+	tests := []struct {
+		blocksAhead uint64
+		reward      *big.Int
+	}{
+		{1, etc(5)},
+		{2, etc(4)},
+		{5000002, etc(3.2)},
+	}
+	for _, tt := range tests {
+		result, err := service.FutureBlockReward(context.Background(), tt.blocksAhead, nil)
+		if err != nil {
+			t.Fatalf("%d blocks ahead: %v", tt.blocksAhead, err)
+		}
+		if result.MinerReward.ToInt().Cmp(tt.reward) != 0 {
+			t.Errorf("%d blocks ahead: reward %v, want %v", tt.blocksAhead, result.MinerReward, tt.reward)
+		}
+	}
+	for _, blocksAhead := range []uint64{maxScheduleEras * 5000000, math.MaxUint64} {
+		if _, err := service.FutureBlockReward(context.Background(), blocksAhead, nil); err == nil {
+			t.Errorf("%d blocks ahead: projection accepted", blocksAhead)
+		}
+	}
+}
+
+// eraSchedule builds an era length schedule from activation, length pairs.
+func eraSchedule(pairs ...uint64) Uint64BigMapEncodesHex {
+	schedule := make(Uint64BigMapEncodesHex)
+	for i := 0; i < len(pairs); i += 2 {
+		schedule[pairs[i]] = new(big.Int).SetUint64(pairs[i+1])
+	}
+	return schedule
+}
+
+func TestEraBoundaries(t *testing.T) {
+	tests := []struct {
+		name      string
+		eraLength uint64
+		schedule  Uint64BigMapEncodesHex
+		starts    []uint64 // First blocks of eras 0, 1, ...
+	}{
+		{"fixed length", 10, nil, []uint64{1, 11, 21, 31}},
+		{"replaced at first block", 10, eraSchedule(1, 4), []uint64{1, 5, 9, 13}},
+		{"replaced at genesis", 10, eraSchedule(0, 4, 25, 3), []uint64{1, 5, 9, 13, 17, 21, 25, 28, 31}},
+		{"zero length", 0, nil, []uint64{1, math.MaxUint64, math.MaxUint64}},
+		{"zero length scheduled", 10, eraSchedule(15, 0), []uint64{1, 11, 15, math.MaxUint64}},
+		{"zero base length", 0, eraSchedule(20, 5), []uint64{1, 20, 25, 30}},
+	}
+	for _, tt := range tests {
+		for era, want := range tt.starts {
+			if start := eraStartBlock(uint64(era), tt.eraLength, tt.schedule); start != want {
+				t.Errorf("%s: era %d starts at %d, want %d", tt.name, era, start, want)
+			}
+		}
+		length := new(big.Int).SetUint64(tt.eraLength)
+		for block := uint64(0); block <= 40; block++ {
+			era := GetBlockEraBySchedule(new(big.Int).SetUint64(block), length, tt.schedule).Uint64()
+			if start := eraStartBlock(era, tt.eraLength, tt.schedule); block > 0 && start > block {
+				t.Errorf("%s: block %d in era %d starting at %d", tt.name, block, era, start)
+			}
+			next := nextEraBlock(block, tt.eraLength, tt.schedule)
+			if start := eraStartBlock(era+1, tt.eraLength, tt.schedule); next != start || next <= block {
+				t.Errorf("%s: block %d: next era at %d, era %d starts at %d", tt.name, block, next, era+1, start)
+			}
+		}
+	}
+}
+
+func TestRewardFromHeader(t *testing.T) {
+	spec := func(number uint64, coinbase byte) HeaderSpec {
+		return HeaderSpec{Number: (*hexutil.Big)(new(big.Int).SetUint64(number)), Coinbase: core.Address{coinbase}}
+	}
+	tests := []struct {
+		number uint64
+		miner  *big.Int
+		uncles []*big.Int // Rewards of uncles one and two blocks back
+	}{
+		// Era 0: uncles earn (8 - distance) / 8 of the block reward
+		{4_000_000, etc(5.3125), []*big.Int{etc(4.375), etc(3.75)}},
+		// Era 1: uncles earn 1/32 of the winner reward
+		{5_000_010, etc(4.25), []*big.Int{etc(0.125), etc(0.125)}},
+	}
+	for _, tt := range tests {
+		uncles := []HeaderSpec{spec(tt.number-1, 2), spec(tt.number-2, 3)}
+		result, err := new(ClassicService).RewardFromHeader(context.Background(), spec(tt.number, 1), uncles, nil)
+		if err != nil {
+			t.Fatalf("block %d: %v", tt.number, err)
+		}
+		if result.MinerReward.ToInt().Cmp(tt.miner) != 0 {
+			t.Errorf("block %d: miner reward %v, want %v", tt.number, result.MinerReward, tt.miner)
+		}
+		for i, uncle := range result.UncleRewards {
+			if uncle.Coinbase != uncles[i].Coinbase || uncle.Reward.ToInt().Cmp(tt.uncles[i]) != 0 {
+				t.Errorf("block %d: uncle %d reward %v to %x, want %v to %x", tt.number, i, uncle.Reward, uncle.Coinbase, tt.uncles[i], uncles[i].Coinbase)
+			}
+		}
+	}
+
+	if _, err := new(ClassicService).RewardFromHeader(context.Background(), spec(100, 1), []HeaderSpec{spec(100, 2)}, nil); !errors.Is(err, errInvalidUncleNumber) {
+		t.Errorf("uncle at the block's height: error %v, want %v", err, errInvalidUncleNumber)
+	}
+	if _, err := new(ClassicService).RewardFromHeader(context.Background(), spec(math.MaxUint64, 1), nil, nil); !errors.Is(err, errEraOutOfRange) {
+		t.Errorf("block %d: error %v, want %v", uint64(math.MaxUint64), err, errEraOutOfRange)
+	}
+}
+
+func TestTrimRewardCache(t *testing.T) {
+	old := rewardCache
+	rewardCache = NewCache[rewardKey, *rewardEntry](rewardCacheSize)
+	t.Cleanup(func() { rewardCache = old })
+
+	for i := int64(1); i <= 10; i++ {
+		cachedRewards(NewPluginConfig(), testHeader(i), nil)
+	}
+	removed, err := new(RewardCacheService).TrimRewardCache(context.Background(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 6 || rewardCache.Len() != 4 {
+		t.Errorf("removed %d entries leaving %d, want 6 leaving 4", removed, rewardCache.Len())
+	}
+	if removed, _ := new(RewardCacheService).TrimRewardCache(context.Background(), 10); removed != 0 {
+		t.Errorf("removed %d entries when keeping more than held, want 0", removed)
+	}
+	if _, err := new(RewardCacheService).TrimRewardCache(context.Background(), -1); err != errInvalidKeepRecent {
+		t.Errorf("negative keep: error %v, want %v", err, errInvalidKeepRecent)
+	}
+}
+
+func TestUncleRewardSchedule(t *testing.T) {
+	schedule, err := new(ClassicService).UncleRewardSchedule(context.Background(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule) != 5 {
+		t.Fatalf("returned %d eras, want 5", len(schedule))
+	}
+	// Era 0 pays (8 - distance) / 8 of the block reward
+	if !schedule[0].DistanceBased || len(schedule[0].ByDistance) != maxUncleDepth {
+		t.Fatalf("era 0: %+v, want %d distance based rewards", schedule[0], maxUncleDepth)
+	}
+	for i, reward := range schedule[0].ByDistance {
+		if want := etc(5 * float64(7-i) / 8); reward.ToInt().Cmp(want) != 0 {
+			t.Errorf("era 0: distance %d reward %v, want %v", i+1, reward, want)
+		}
+	}
+	// Later eras pay 1/32 of a winner reward decaying by a fifth per era
+	for era, want := range []*big.Int{nil, etc(0.125), etc(0.1), etc(0.08), etc(0.064)} {
+		if era == 0 {
+			continue
+		}
+		if info := schedule[era]; info.DistanceBased || info.Reward.ToInt().Cmp(want) != 0 {
+			t.Errorf("era %d: reward %v (distance based %v), want %v", era, info.Reward, info.DistanceBased, want)
+		}
+	}
+	for _, eras := range []int{0, maxScheduleEras + 1} {
+		if _, err := new(ClassicService).UncleRewardSchedule(context.Background(), eras); err != errInvalidEraCount {
+			t.Errorf("%d eras: error %v, want %v", eras, err, errInvalidEraCount)
+		}
+	}
+}
+
+func TestNextEraBlock(t *testing.T) {
+	// Era 1 spans blocks 5,000,001 to 10,000,000
+	for _, head := range []int64{5000001, 7500000, 10000000} {
+		next, err := testService(head).NextEraBlock(context.Background())
+		if err != nil {
+			t.Fatalf("head %d: %v", head, err)
+		}
+		if next != 10000001 {
+			t.Errorf("head %d: next era at %d, want 10000001", head, next)
+		}
+	}
+	if next, _ := testService(4999999).NextEraBlock(context.Background()); next != 5000001 {
+		t.Errorf("head 4999999: next era at %d, want 5000001", next)
+	}
+}
+
+// testBlock returns a block with the given number mined by coinbase, including
+// uncles of the given coinbases one block back.
+func testBlock(number int64, coinbase byte, uncles ...byte) *types.Block {
+	header := &types.Header{Number: big.NewInt(number), Difficulty: big.NewInt(1), Coinbase: core.Address{coinbase}}
+	var uncleHeaders []*types.Header
+	for _, uncle := range uncles {
+		uncleHeaders = append(uncleHeaders, &types.Header{Number: big.NewInt(number - 1), Difficulty: big.NewInt(1), Coinbase: core.Address{uncle}})
+	}
+	return types.NewBlock(header, nil, uncleHeaders, nil, nil)
+}
+
+func TestGetBlockRewardByHash(t *testing.T) {
+	var (
+		canonical = testBlock(4_000_000, 1, 2)
+		side      = testBlock(4_000_000, 3)
+		backend   = newTestChain(canonical)
+		service   = &ClassicService{backend: backend}
+	)
+	backend.blocks[side.Hash()] = side
+
+	byNumber, err := service.BlockReward(context.Background(), restricted.BlockNumber(4_000_000), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byHash, err := service.GetBlockRewardByHash(context.Background(), canonical.Hash(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byHash.MinerReward.ToInt().Cmp(byNumber.MinerReward.ToInt()) != 0 || byHash.Coinbase != byNumber.Coinbase || len(byHash.UncleRewards) != len(byNumber.UncleRewards) {
+		t.Errorf("reward by hash %+v, by number %+v", byHash, byNumber)
+	}
+	if byHash.MinerReward.ToInt().Cmp(etc(5.15625)) != 0 {
+		t.Errorf("miner reward %v, want 5.15625 ETC", byHash.MinerReward)
+	}
+
+	// Side chain blocks are found by hash
+	result, err := service.GetBlockRewardByHash(context.Background(), side.Hash(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Coinbase != side.Coinbase() || result.MinerReward.ToInt().Cmp(etc(5)) != 0 {
+		t.Errorf("side block reward %v to %x, want 5 ETC to %x", result.MinerReward, result.Coinbase, side.Coinbase())
+	}
+	if _, err := service.GetBlockRewardByHash(context.Background(), core.Hash{1}, nil); err != errUnknownBlock {
+		t.Errorf("unknown hash: error %v, want %v", err, errUnknownBlock)
+	}
+}
+
+func TestMonetaryPolicy(t *testing.T) {
+	policy, err := testService(12_000_000).MonetaryPolicy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.EraLength != 5_000_000 {
+		t.Errorf("era length %d, want 5000000", policy.EraLength)
+	}
+	if policy.DisinflationNum.ToInt().Int64() != 4 || policy.DisinflationDenom.ToInt().Int64() != 5 {
+		t.Errorf("disinflation rate %v/%v, want 4/5", policy.DisinflationNum, policy.DisinflationDenom)
+	}
+	if policy.ECIP1017Block == nil || *policy.ECIP1017Block != 5_000_000 {
+		t.Errorf("ECIP-1017 block %v, want 5000000", policy.ECIP1017Block)
+	}
+	if policy.BaseReward.ToInt().Cmp(etc(5)) != 0 || policy.CurrentEra != 2 || policy.CurrentEraReward.ToInt().Cmp(etc(3.2)) != 0 {
+		t.Errorf("base reward %v, era %d paying %v, want 5 ETC, era 2 paying 3.2 ETC", policy.BaseReward, policy.CurrentEra, policy.CurrentEraReward)
+	}
+}
+
+func TestBlockRewardConstants(t *testing.T) {
+	constants, err := new(ClassicService).BlockRewardConstants(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if constants.FrontierBlockReward.ToInt().Cmp(etc(5)) != 0 {
+		t.Errorf("Frontier reward %v, want 5 ETC", constants.FrontierBlockReward)
+	}
+	if constants.EIP649FBlockReward.ToInt().Cmp(etc(3)) != 0 || constants.EIP1234FBlockReward.ToInt().Cmp(etc(2)) != 0 {
+		t.Errorf("EIP-649 and EIP-1234 rewards %v and %v, want 3 and 2 ETC", constants.EIP649FBlockReward, constants.EIP1234FBlockReward)
+	}
+	if constants.DisinflationRateQuotient.ToInt().Int64() != 4 || constants.DisinflationRateDivisor.ToInt().Int64() != 5 {
+		t.Errorf("disinflation rate %v/%v, want 4/5", constants.DisinflationRateQuotient, constants.DisinflationRateDivisor)
+	}
+	// The result holds copies of the constants
+	constants.FrontierBlockReward.ToInt().SetInt64(0)
+	if FrontierBlockReward.Sign() == 0 {
+		t.Error("FrontierBlockReward modified through the result")
+	}
+}
+
+func TestBlockReward(t *testing.T) {
+	service := &ClassicService{backend: newTestChain(testBlock(4_000_000, 1), testBlock(12_000_000, 1, 2, 3))}
+
+	tests := []struct {
+		number restricted.BlockNumber
+		miner  *big.Int
+		uncles []*big.Int
+	}{
+		{4_000_000, etc(5), nil},
+		// Era 2: 3.2 ETC plus 1/32 of it per uncle, uncles earn 1/32 too
+		{12_000_000, etc(3.4), []*big.Int{etc(0.1), etc(0.1)}},
+		{restricted.LatestBlockNumber, etc(3.4), []*big.Int{etc(0.1), etc(0.1)}},
+	}
+	for _, tt := range tests {
+		result, err := service.BlockReward(context.Background(), tt.number, nil)
+		if err != nil {
+			t.Fatalf("block %d: %v", tt.number, err)
+		}
+		if result.MinerReward.ToInt().Cmp(tt.miner) != 0 || len(result.UncleRewards) != len(tt.uncles) {
+			t.Fatalf("block %d: miner reward %v with %d uncle rewards, want %v with %d", tt.number, result.MinerReward, len(result.UncleRewards), tt.miner, len(tt.uncles))
+		}
+		for i, uncle := range result.UncleRewards {
+			if uncle.Reward.ToInt().Cmp(tt.uncles[i]) != 0 {
+				t.Errorf("block %d: uncle %d reward %v, want %v", tt.number, i, uncle.Reward, tt.uncles[i])
+			}
+		}
+	}
+	if _, err := service.BlockReward(context.Background(), 5, nil); err != errUnknownBlock {
+		t.Errorf("unknown block: error %v, want %v", err, errUnknownBlock)
+	}
+}
+
+func TestECIP1017Schedule(t *testing.T) {
+	schedule, err := new(ClassicService).ECIP1017Schedule(context.Background(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []EraInfo{
+		{0, 1, 5000000, (*hexutil.Big)(etc(5))},
+		{1, 5000001, 10000000, (*hexutil.Big)(etc(4))},
+		{2, 10000001, 15000000, (*hexutil.Big)(etc(3.2))},
+		{3, 15000001, 20000000, (*hexutil.Big)(etc(2.56))},
+	}
+	if len(schedule) != len(want) {
+		t.Fatalf("%d eras, want %d", len(schedule), len(want))
+	}
+	eraLength := big.NewInt(5000000)
+	for i, info := range schedule {
+		if info.Era != want[i].Era || info.StartBlock != want[i].StartBlock || info.EndBlock != want[i].EndBlock || info.Reward.ToInt().Cmp(want[i].Reward.ToInt()) != 0 {
+			t.Errorf("era %d: %+v, want %+v", i, info, want[i])
+		}
+		// The boundaries agree with the era consensus assigns to the blocks
+		for _, block := range []uint64{info.StartBlock, info.EndBlock} {
+			if era := GetBlockEra(new(big.Int).SetUint64(block), eraLength); era.Uint64() != info.Era {
+				t.Errorf("era %d: block %d in era %v", info.Era, block, era)
+			}
+		}
+	}
+	for _, eras := range []int{0, maxScheduleEras + 1} {
+		if _, err := new(ClassicService).ECIP1017Schedule(context.Background(), eras); err != errInvalidEraCount {
+			t.Errorf("%d eras: error %v, want %v", eras, err, errInvalidEraCount)
+		}
+	}
+}
+
+func TestEraForBlock(t *testing.T) {
+	service := testService(10000001)
+	tests := []struct {
+		block restricted.BlockNumber
+		era   uint64
+	}{
+		{0, 0},
+		{5000000, 0},
+		{5000001, 1},
+		{10000000, 1},
+		{restricted.LatestBlockNumber, 2},
+		{restricted.PendingBlockNumber, 2},
+	}
+	for _, tt := range tests {
+		era, err := service.EraForBlock(context.Background(), tt.block)
+		if err != nil {
+			t.Fatalf("block %d: %v", tt.block, err)
+		}
+		if era != tt.era {
+			t.Errorf("block %d: era %d, want %d", tt.block, era, tt.era)
+		}
+	}
+}
+
+func TestUncleInclusionReward(t *testing.T) {
+	tests := []struct {
+		block    *types.Block
+		ecip1017 bool
+		reward   *big.Int
+	}{
+		// 1/32 of the 5 ETC block reward per uncle
+		{testBlock(4_000_000, 1, 2, 3), false, etc(0.3125)},
+		// 1/32 of the 4 ETC winner reward of era 1 per uncle
+		{testBlock(6_000_000, 1, 2, 3), true, etc(0.25)},
+		{testBlock(6_000_000, 1), true, new(big.Int)},
+	}
+	for _, tt := range tests {
+		service := &ClassicService{backend: newTestChain(tt.block)}
+		result, err := service.UncleInclusionReward(context.Background(), restricted.BlockNumber(tt.block.NumberU64()))
+		if err != nil {
+			t.Fatalf("block %d: %v", tt.block.NumberU64(), err)
+		}
+		if result.Uncles != len(tt.block.Uncles()) || result.ECIP1017 != tt.ecip1017 || result.Reward.ToInt().Cmp(tt.reward) != 0 {
+			t.Errorf("block %d: %d uncles, ECIP-1017 %v, bonus %v, want %d, %v, %v", tt.block.NumberU64(), result.Uncles, result.ECIP1017, result.Reward, len(tt.block.Uncles()), tt.ecip1017, tt.reward)
+		}
+	}
+}
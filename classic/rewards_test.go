@@ -0,0 +1,347 @@
+package main
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// componentRewards computes the miner and uncle rewards of a block from the
+// individual reward functions, independently of GetRewards.
+func componentRewards(config *PluginConfigurator, header *types.Header, uncles []*types.Header) (*big.Int, []*big.Int) {
+	uncleRewards := make([]*big.Int, len(uncles))
+	if !config.IsEnabled(config.GetEthashECIP1017Transition, header.Number) {
+		blockReward := EthashBlockReward(config, header.Number)
+		miner := new(big.Int).Set(blockReward)
+		for i, uncle := range uncles {
+			miner.Add(miner, new(big.Int).Div(blockReward, big32))
+
+			distance := new(big.Int).Sub(new(big.Int).Add(uncle.Number, big8), header.Number)
+			uncleRewards[i] = distance.Div(distance.Mul(distance, blockReward), big8)
+		}
+		return miner, uncleRewards
+	}
+	eraLength := new(big.Int).SetUint64(*config.GetEthashECIP1017EraRounds())
+	era := GetBlockEraBySchedule(header.Number, eraLength, config.GetEthashECIP1017EraRoundsSchedule())
+
+	miner := GetBlockWinnerRewardByEra(era, FrontierBlockReward)
+	for i, uncle := range uncles {
+		miner.Add(miner, new(big.Int).Div(GetBlockWinnerRewardByEra(era, FrontierBlockReward), big32))
+		uncleRewards[i] = GetBlockUncleRewardByEra(era, header, uncle, FrontierBlockReward)
+	}
+	return miner, uncleRewards
+}
+
+// checkRewardComponents asserts that GetRewards, and ecip1017BlockReward once
+// ECIP-1017 is active, agree with componentRewards for the given block.
+func checkRewardComponents(t *testing.T, number uint64, distances []uint64) {
+	t.Helper()
+
+	config := NewPluginConfig()
+	header := &types.Header{Number: new(big.Int).SetUint64(number)}
+	uncles := make([]*types.Header, len(distances))
+	for i, distance := range distances {
+		uncles[i] = &types.Header{Number: new(big.Int).SetUint64(number - distance)}
+	}
+	wantMiner, wantUncles := componentRewards(config, header, uncles)
+
+	check := func(name string, miner *big.Int, uncleRewards []*big.Int) {
+		if miner.Cmp(wantMiner) != 0 {
+			t.Errorf("block %d, distances %v: %s miner reward %v, want %v", number, distances, name, miner, wantMiner)
+		}
+		total, wantTotal := new(big.Int).Set(miner), new(big.Int).Set(wantMiner)
+		for i := range uncleRewards {
+			if uncleRewards[i].Cmp(wantUncles[i]) != 0 {
+				t.Errorf("block %d, distances %v: %s uncle %d reward %v, want %v", number, distances, name, i, uncleRewards[i], wantUncles[i])
+			}
+			total.Add(total, uncleRewards[i])
+			wantTotal.Add(wantTotal, wantUncles[i])
+		}
+		if total.Cmp(wantTotal) != 0 {
+			t.Errorf("block %d, distances %v: %s total %v, want %v", number, distances, name, total, wantTotal)
+		}
+	}
+	miner, uncleRewards := GetRewards(config, header, uncles)
+	check("GetRewards", miner, uncleRewards)
+
+	if config.IsEnabled(config.GetEthashECIP1017Transition, header.Number) {
+		miner, uncleRewards := ecip1017BlockReward(config, header, uncles)
+		check("ecip1017BlockReward", miner, uncleRewards)
+	}
+}
+
+func TestRewardComponentsConsistency(t *testing.T) {
+	// Blocks on both sides of ECIP-1017 and of the following era boundaries
+	for _, number := range []uint64{8, 1920000, 4999999, 5000000, 5000001, 10000000, 10000001, 20000001} {
+		for _, distances := range [][]uint64{nil, {1}, {7}, {1, 2}, {3, 7}} {
+			checkRewardComponents(t, number, distances)
+		}
+	}
+	// Random blocks, up to era 40, with up to two uncles
+	rng := rand.New(rand.NewSource(1017))
+	for i := 0; i < 2000; i++ {
+		number := maxUncleDepth + uint64(rng.Int63n(200000000))
+		if i%2 == 0 {
+			number = maxUncleDepth + uint64(rng.Int63n(5000000))
+		}
+		distances := make([]uint64, rng.Intn(3))
+		for j := range distances {
+			distances[j] = 1 + uint64(rng.Intn(maxUncleDepth))
+		}
+		checkRewardComponents(t, number, distances)
+	}
+}
+
+func FuzzRewardComponentsConsistency(f *testing.F) {
+	f.Add(uint64(4999999), uint8(1), uint8(2), uint8(2))
+	f.Add(uint64(5000001), uint8(7), uint8(1), uint8(2))
+	f.Add(uint64(15000000), uint8(3), uint8(0), uint8(1))
+	f.Fuzz(func(t *testing.T, number uint64, first, second, count uint8) {
+		// Stay within the eras the reward schedule RPCs expose
+		number = maxUncleDepth + number%(maxScheduleEras*5000000)
+		distances := []uint64{1 + uint64(first)%maxUncleDepth, 1 + uint64(second)%maxUncleDepth}
+		checkRewardComponents(t, number, distances[:count%3])
+	})
+}
+
+// testStateDB records the balances credited to it. StateDB methods it does not
+// override panic, the embedded interface being nil.
+type testStateDB struct {
+	core.RWStateDB
+	balances map[core.Address]*big.Int
+}
+
+func (db *testStateDB) AddBalance(addr core.Address, amount *big.Int) {
+	if db.balances[addr] == nil {
+		db.balances[addr] = new(big.Int)
+	}
+	db.balances[addr].Add(db.balances[addr], amount)
+}
+
+func TestAccumulateRewardsEngine(t *testing.T) {
+	header := &types.Header{Number: big.NewInt(5000001), Coinbase: core.HexToAddress("0x01")}
+	uncles := []*types.Header{{Number: big.NewInt(5000000), Coinbase: core.HexToAddress("0x02")}}
+
+	ethash := &testStateDB{balances: make(map[core.Address]*big.Int)}
+	AccumulateRewards(NewPluginConfig(), ethash, header, uncles)
+	if len(ethash.balances) != 2 {
+		t.Errorf("ethash credited %v, want the miner and the uncle", ethash.balances)
+	}
+
+	config := *NewPluginConfig()
+	config.Clique = &CliqueConfig{Period: 15, Epoch: 30000}
+	clique := &testStateDB{balances: make(map[core.Address]*big.Int)}
+	AccumulateRewards(&config, clique, header, uncles)
+	if len(clique.balances) != 0 {
+		t.Errorf("clique credited %v, want nothing", clique.balances)
+	}
+}
+
+func TestRewardsEraLengthSchedule(t *testing.T) {
+	// Eras of 5,000,000 blocks shortened to 1,000,000 from block 10,000,001
+	config := *NewPluginConfig()
+	config.ECIP1017EraRoundsSchedule = Uint64BigMapEncodesHex{10000001: big.NewInt(1000000)}
+
+	tests := []struct {
+		number uint64
+		era    uint64
+		reward *big.Int
+	}{
+		{5000000, 0, etc(5)},
+		{5000001, 1, etc(4)},
+		{10000000, 1, etc(4)},
+		{10000001, 2, etc(3.2)},
+		{11000000, 2, etc(3.2)},
+		{11000001, 3, etc(2.56)},
+		{12000001, 4, etc(2.048)},
+	}
+	eraLength := new(big.Int).SetUint64(*config.GetEthashECIP1017EraRounds())
+	for _, tt := range tests {
+		header := &types.Header{Number: new(big.Int).SetUint64(tt.number)}
+		if era := GetBlockEraBySchedule(header.Number, eraLength, config.GetEthashECIP1017EraRoundsSchedule()); era.Uint64() != tt.era {
+			t.Errorf("block %d: era %v, want %d", tt.number, era, tt.era)
+		}
+		if reward, _ := GetRewards(&config, header, nil); reward.Cmp(tt.reward) != 0 {
+			t.Errorf("block %d: reward %v, want %v", tt.number, reward, tt.reward)
+		}
+	}
+}
+
+func TestEraStartBlock(t *testing.T) {
+	for era, want := range []uint64{1, 5_000_001, 10_000_001, 15_000_001} {
+		start := EraStartBlock(uint64(era))
+		if start != want {
+			t.Errorf("era %d starts at %d, want %d", era, start, want)
+		}
+		// Inverse of GetBlockEra
+		if got := GetBlockEra(new(big.Int).SetUint64(start), big.NewInt(5_000_000)); got.Uint64() != uint64(era) {
+			t.Errorf("first block %d of era %d maps to era %v", start, era, got)
+		}
+		if got := GetBlockEra(new(big.Int).SetUint64(start-1), big.NewInt(5_000_000)); era > 0 && got.Uint64() != uint64(era-1) {
+			t.Errorf("block %d before era %d maps to era %v", start-1, era, got)
+		}
+	}
+}
+
+func TestFinalizeEraBoundary(t *testing.T) {
+	var (
+		miner  = core.HexToAddress("0x01")
+		first  = core.HexToAddress("0x02")
+		second = core.HexToAddress("0x03")
+		ethash = &Ethash{pluginConfig: NewPluginConfig()}
+	)
+	tests := []struct {
+		number   int64
+		uncles   int
+		balances map[core.Address]*big.Int
+	}{
+		// Last block of era 0: uncles earn (8 - distance) / 8 of 5 ETC
+		{5_000_000, 2, map[core.Address]*big.Int{miner: etc(5.3125), first: etc(4.375), second: etc(3.75)}},
+		// First block of era 1: 4 ETC, uncles earn 1/32 of it
+		{5_000_001, 2, map[core.Address]*big.Int{miner: etc(4.25), first: etc(0.125), second: etc(0.125)}},
+		{5_000_001, 0, map[core.Address]*big.Int{miner: etc(4)}},
+	}
+	for _, tt := range tests {
+		header := &types.Header{Number: big.NewInt(tt.number), Coinbase: miner}
+		uncles := []*types.Header{
+			{Number: big.NewInt(tt.number - 1), Coinbase: first},
+			{Number: big.NewInt(tt.number - 2), Coinbase: second},
+		}[:tt.uncles]
+
+		state := &testStateDB{balances: make(map[core.Address]*big.Int)}
+		ethash.Finalize(nil, header, state, nil, uncles, nil)
+		if len(state.balances) != len(tt.balances) {
+			t.Errorf("block %d with %d uncles: credited %v, want %v", tt.number, tt.uncles, state.balances, tt.balances)
+			continue
+		}
+		for addr, want := range tt.balances {
+			if balance := state.balances[addr]; balance == nil || balance.Cmp(want) != 0 {
+				t.Errorf("block %d with %d uncles: %x credited %v, want %v", tt.number, tt.uncles, addr, balance, want)
+			}
+		}
+	}
+}
+
+func TestRewardsMalformedUncles(t *testing.T) {
+	var (
+		miner = core.HexToAddress("0x01")
+		uncle = core.HexToAddress("0x02")
+	)
+	tests := []struct {
+		number int64
+		uncles []*types.Header
+		miner  *big.Int
+		uncle  *big.Int // Reward of the well formed uncle, if any
+	}{
+		{100, nil, etc(5), nil},
+		{100, []*types.Header{nil}, etc(5), nil},
+		{100, []*types.Header{{Coinbase: uncle}}, etc(5), nil},
+		{100, []*types.Header{nil, {Number: big.NewInt(99), Coinbase: uncle}}, etc(5.15625), etc(4.375)},
+		{5000001, nil, etc(4), nil},
+		{5000001, []*types.Header{nil}, etc(4), nil},
+		{5000001, []*types.Header{{Coinbase: uncle}}, etc(4), nil},
+		{5000001, []*types.Header{{Coinbase: uncle}, {Number: big.NewInt(5000000), Coinbase: uncle}}, etc(4.125), etc(0.125)},
+	}
+	for i, tt := range tests {
+		header := &types.Header{Number: big.NewInt(tt.number), Coinbase: miner}
+		reward, uncleRewards := GetRewards(NewPluginConfig(), header, tt.uncles)
+		if reward.Cmp(tt.miner) != 0 {
+			t.Errorf("test %d: miner reward %v, want %v", i, reward, tt.miner)
+		}
+		if len(uncleRewards) != len(tt.uncles) {
+			t.Fatalf("test %d: %d uncle rewards for %d uncles", i, len(uncleRewards), len(tt.uncles))
+		}
+		for j, u := range tt.uncles {
+			if !wellFormedUncle(u) && uncleRewards[j].Sign() != 0 {
+				t.Errorf("test %d: malformed uncle %d rewarded %v", i, j, uncleRewards[j])
+			}
+		}
+
+		state := &testStateDB{balances: make(map[core.Address]*big.Int)}
+		AccumulateRewards(NewPluginConfig(), state, header, tt.uncles)
+		if state.balances[miner].Cmp(tt.miner) != 0 {
+			t.Errorf("test %d: miner credited %v, want %v", i, state.balances[miner], tt.miner)
+		}
+		if got := state.balances[uncle]; (got == nil) != (tt.uncle == nil) || (got != nil && got.Cmp(tt.uncle) != 0) {
+			t.Errorf("test %d: uncle credited %v, want %v", i, got, tt.uncle)
+		}
+	}
+}
+
+// rewardRange returns count contiguous headers from block first, every third
+// block including an uncle one block back.
+func rewardRange(first uint64, count int) ([]*types.Header, map[uint64][]*types.Header) {
+	headers := make([]*types.Header, count)
+	uncles := make(map[uint64][]*types.Header)
+	for i := range headers {
+		number := first + uint64(i)
+		headers[i] = &types.Header{Number: new(big.Int).SetUint64(number)}
+		if number%3 == 0 {
+			uncles[number] = []*types.Header{{Number: new(big.Int).SetUint64(number - 1)}}
+		}
+	}
+	return headers, uncles
+}
+
+func TestGetRewardsForRange(t *testing.T) {
+	config := NewPluginConfig()
+
+	// Across the ECIP-1017 transition and the first era boundary
+	headers, uncles := rewardRange(4999990, 30)
+	rewards, err := GetRewardsForRange(config, headers, uncles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, header := range headers {
+		if want, _ := GetRewards(config, header, uncles[header.Number.Uint64()]); rewards[i].Cmp(want) != 0 {
+			t.Errorf("block %v: reward %v, want %v", header.Number, rewards[i], want)
+		}
+	}
+
+	headers[5] = &types.Header{Number: big.NewInt(1)}
+	if _, err := GetRewardsForRange(config, headers, uncles); err == nil {
+		t.Error("no error for headers that are not contiguous")
+	}
+	headers[5] = &types.Header{}
+	if _, err := GetRewardsForRange(config, headers, uncles); err != errMalformedHeader {
+		t.Errorf("header without a number: error %v, want %v", err, errMalformedHeader)
+	}
+}
+
+func BenchmarkGetRewardsForRange(b *testing.B) {
+	config := NewPluginConfig()
+	headers, uncles := rewardRange(9990000, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GetRewardsForRange(config, headers, uncles)
+	}
+}
+
+func BenchmarkGetRewardsLoop(b *testing.B) {
+	config := NewPluginConfig()
+	headers, uncles := rewardRange(9990000, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, header := range headers {
+			GetRewards(config, header, uncles[header.Number.Uint64()])
+		}
+	}
+}
+
+func TestGetBlockEraInvalidLength(t *testing.T) {
+	for _, eraLength := range []*big.Int{nil, new(big.Int), big.NewInt(-5000000)} {
+		for _, block := range []int64{-1, 0, 1, 5000001, 100000000} {
+			if era := GetBlockEra(big.NewInt(block), eraLength); era.Sign() != 0 {
+				t.Errorf("block %d, era length %v: era %v, want 0", block, eraLength, era)
+			}
+		}
+		// A single era schedule starting at the genesis carries the bad length
+		schedule := Uint64BigMapEncodesHex{0: eraLength}
+		if era := GetBlockEraBySchedule(big.NewInt(5000001), big.NewInt(5000000), schedule); era.Sign() != 0 {
+			t.Errorf("scheduled era length %v: era %v, want 0", eraLength, era)
+		}
+	}
+}
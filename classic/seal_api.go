@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+var (
+	errEngineNotReady  = errors.New("ethash engine not initialized")
+	errDatasetNotReady = errors.New("ethash dataset not generated")
+	errEpochOutOfRange = errors.New("ethash epoch out of range")
+)
+
+// epochLimit returns the first block past the epoch following the one of the
+// current head. Caches are only ever needed below it.
+func (service *ClassicService) epochLimit(ecip1099Block *uint64) (uint64, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return 0, err
+	}
+	number := head.Number.Uint64()
+	epochLength := calcEpochLength(number, ecip1099Block)
+	nextEpoch, nextEpochLength := calcNextEpoch(calcEpoch(number, epochLength), epochLength, ecip1099Block)
+	return (nextEpoch + 1) * nextEpochLength, nil
+}
+
+// checkEpoch rejects a caller supplied block number at or beyond limit, as
+// returned by epochLimit, or past the precomputed ethash size tables. It must
+// be called before looking up a cache, otherwise a single request could make
+// the node generate caches of arbitrary size for far future epochs.
+func checkEpoch(number, limit uint64, ecip1099Block *uint64) error {
+	epoch := calcEpoch(number, calcEpochLength(number, ecip1099Block))
+	if number >= limit || epoch >= maxEpoch {
+		return fmt.Errorf("%w: block %d is in epoch %d", errEpochOutOfRange, number, epoch)
+	}
+	return nil
+}
+
+// SealSpec is a proof-of-work solution for a header as submitted by a miner.
+type SealSpec struct {
+	Header    HeaderSpec       `json:"header"`
+	Nonce     types.BlockNonce `json:"nonce"`
+	MixDigest core.Hash        `json:"mixDigest"`
+}
+
+// VerifySeals verifies a batch of proof-of-work solutions against the
+// verification caches of their epochs, returning the verdicts in input order.
+// Solutions sharing an epoch share a single cache lookup.
+func (service *ClassicService) VerifySeals(ctx context.Context, seals []SealSpec) ([]bool, error) {
+	ethash := eHashForAPI
+	if ethash == nil {
+		return nil, errEngineNotReady
+	}
+	limit, err := service.epochLimit(ethash.config.ECIP1099Block)
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]*types.Header, len(seals))
+	for i, seal := range seals {
+		header, err := seal.Header.toHeader()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkEpoch(header.Number.Uint64(), limit, ethash.config.ECIP1099Block); err != nil {
+			return nil, err
+		}
+		header.Nonce, header.MixDigest = seal.Nonce, seal.MixDigest
+		headers[i] = header
+	}
+	release, err := heavyRPCs.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var (
+		results = make([]bool, len(seals))
+		caches  = make(map[uint64]*cache)
+	)
+	defer func() {
+		for _, c := range caches {
+			c.unref()
+		}
+	}()
+	for i, header := range headers {
+		number := header.Number.Uint64()
+		epochLength := calcEpochLength(number, ethash.config.ECIP1099Block)
+		key := epochLength + calcEpoch(number, epochLength)
+		c, ok := caches[key]
+		if !ok {
+			c = ethash.cache(number)
+			caches[key] = c
+		}
+		results[i] = ethash.verifySealLight(header, c) == nil
+	}
+	return results, nil
+}
+
+var (
+	errInvalidMixDigestLength = errors.New("mix digest must be exactly 32 bytes")
+	errInvalidCacheLength     = errors.New("cache length does not match the epoch's cache size")
+)
+
+// VerifyWithCache verifies a proof-of-work solution against a verification
+// cache supplied by the caller rather than the node's own, allowing the
+// caller's cache to be cross-checked. The cache is expected in little endian
+// byte order and must match the size of the header's epoch.
+//
+// Classic verification caches are 16 MB and up, over 32 MB once hex encoded,
+// which exceeds the 5 MB request body limit of the HTTP and WebSocket servers.
+// The method is therefore only usable over IPC.
+func (service *ClassicService) VerifyWithCache(ctx context.Context, header HeaderSpec, nonce hexutil.Uint64, mixDigest hexutil.Bytes, cache hexutil.Bytes) (bool, error) {
+	ethash := eHashForAPI
+	if ethash == nil {
+		return false, errEngineNotReady
+	}
+	if len(mixDigest) != len(core.Hash{}) {
+		return false, errInvalidMixDigestLength
+	}
+	h, err := header.toHeader()
+	if err != nil {
+		return false, err
+	}
+	if h.Difficulty.Sign() <= 0 {
+		return false, errInvalidDifficulty
+	}
+	h.Nonce = types.EncodeNonce(uint64(nonce))
+	h.MixDigest = core.BytesToHash(mixDigest)
+
+	// The cache comes from the caller, so only the size tables bound the epoch
+	number := h.Number.Uint64()
+	if err := checkEpoch(number, math.MaxUint64, ethash.config.ECIP1099Block); err != nil {
+		return false, err
+	}
+	epoch := calcEpoch(number, calcEpochLength(number, ethash.config.ECIP1099Block))
+	if uint64(len(cache)) != cacheSize(epoch) {
+		return false, errInvalidCacheLength
+	}
+	release, err := heavyRPCs.acquire()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	words := make([]uint32, len(cache)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(cache[i*4:])
+	}
+	digest, result := hashimotoLight(datasetSize(epoch), words, ethash.SealHash(h).Bytes(), h.Nonce.Uint64())
+	return verifyPoWResult(h, digest, result) == nil, nil
+}
+
+// errFutureUncle is returned for uncles numbered past the current head.
+var errFutureUncle = errors.New("uncle is newer than the current head")
+
+// VerifyUnclePoW checks the proof-of-work of an uncle header, using the nonce
+// and mix digest it carries, against the verification cache of its epoch.
+// Uncles can only be included by blocks up to one past the head and must
+// precede them, so uncles numbered past the head are rejected.
+func (service *ClassicService) VerifyUnclePoW(ctx context.Context, uncle HeaderSpec) (bool, error) {
+	if uncle.Number == nil {
+		return false, errMissingHeaderNumber
+	}
+	head, err := service.headHeader()
+	if err != nil {
+		return false, err
+	}
+	if uncle.Number.ToInt().Cmp(head.Number) > 0 {
+		return false, errFutureUncle
+	}
+	verdicts, err := service.VerifySeals(ctx, []SealSpec{{Header: uncle, Nonce: uncle.Nonce, MixDigest: uncle.MixDigest}})
+	if err != nil {
+		return false, err
+	}
+	return verdicts[0], nil
+}
+
+// headerByNumber decodes the header with the given number as reported by the
+// backend.
+func (service *ClassicService) headerByNumber(ctx context.Context, blockNr restricted.BlockNumber) (*types.Header, error) {
+	data, err := service.backend.HeaderByNumber(ctx, int64(blockNr))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errUnknownBlock
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// VerifyHeader checks the ethash seal of the given block against the mining
+// dataset of its epoch. If the dataset is not in memory yet its generation is
+// started in the background and an error is returned, so the call can be
+// retried once the dataset is available.
+func (service *DatasetService) VerifyHeader(ctx context.Context, number restricted.BlockNumber) (bool, error) {
+	ethash := eHashForAPI
+	if ethash == nil {
+		return false, errEngineNotReady
+	}
+	header, err := service.classic.headerByNumber(ctx, number)
+	if err != nil {
+		return false, err
+	}
+	if header.Difficulty.Sign() <= 0 {
+		return false, errInvalidDifficulty
+	}
+	release, err := heavyRPCs.acquire()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	block := header.Number.Uint64()
+	dataset := ethash.dataset(block, true)
+	defer dataset.unref()
+	if !dataset.generated() {
+		return false, fmt.Errorf("%w: epoch %d (length %d) is being generated", errDatasetNotReady, dataset.epoch, dataset.epochLength)
+	}
+	digest, result := hashimotoFull(dataset.dataset, ethash.SealHash(header).Bytes(), header.Nonce.Uint64())
+
+	// Datasets are unmapped in a finalizer, keep it alive until hashimotoFull is done.
+	runtime.KeepAlive(dataset)
+
+	return verifyPoWResult(header, digest, result) == nil, nil
+}
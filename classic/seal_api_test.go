@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// newTestEthash installs a test mode ethash engine, using tiny caches, for
+// the RPCs for the duration of the test.
+func newTestEthash(t *testing.T) *Ethash {
+	ethash := New(Config{PowMode: ModeTest, CachesInMem: 2, DatasetsInMem: 1}, nil, false)
+	old := eHashForAPI
+	eHashForAPI = ethash
+	t.Cleanup(func() {
+		eHashForAPI = old
+		// Background generations would otherwise publish events into the
+		// feeds of later tests.
+		waitForGenerations(ethash.caches)
+		waitForGenerations(ethash.datasets)
+		ethash.Close()
+	})
+	return ethash
+}
+
+// waitForGenerations blocks until the items of lru, including the ones being
+// generated in the background, are generated. Items whose generation has not
+// started are generated in place, test sized.
+func waitForGenerations[T cacheOrDataset](lru *lru[T]) {
+	lru.mu.Lock()
+	items := lru.cache.Values()
+	for _, item := range lru.futureItems {
+		items = append(items, item)
+	}
+	for _, item := range lru.inflight {
+		items = append(items, item)
+	}
+	lru.mu.Unlock()
+
+	for _, item := range items {
+		switch item := any(item).(type) {
+		case *cache:
+			item.generate("", 0, false, true)
+		case *dataset:
+			item.generate("", 0, false, true)
+		}
+	}
+}
+
+// testSealSpec returns a solution for the block with the given number, with a
+// valid mix digest if valid is set. Test headers have a difficulty of one, so
+// any nonce meets the target.
+func testSealSpec(ethash *Ethash, number int64, nonce uint64, valid bool) SealSpec {
+	header := testHeader(number)
+	header.Nonce = types.EncodeNonce(nonce)
+
+	c := ethash.cache(uint64(number))
+	digest, _ := hashimotoLight(32*1024, c.cache, ethash.SealHash(header).Bytes(), nonce)
+	c.unref()
+
+	mixDigest := core.BytesToHash(digest)
+	if !valid {
+		mixDigest[0] ^= 0xff
+	}
+	return SealSpec{
+		Header: HeaderSpec{
+			Number:     (*hexutil.Big)(header.Number),
+			Difficulty: (*hexutil.Big)(header.Difficulty),
+		},
+		Nonce:     header.Nonce,
+		MixDigest: mixDigest,
+	}
+}
+
+func TestVerifySeals(t *testing.T) {
+	ethash := newTestEthash(t)
+	service := testService(epochLengthDefault + 5)
+
+	seals := []SealSpec{
+		testSealSpec(ethash, 1, 7, true),
+		testSealSpec(ethash, epochLengthDefault+1, 8, false),
+		testSealSpec(ethash, 2, 9, false),
+		testSealSpec(ethash, epochLengthDefault+2, 10, true),
+	}
+	verdicts, err := service.VerifySeals(context.Background(), seals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bool{true, false, false, true}
+	for i := range want {
+		if verdicts[i] != want[i] {
+			t.Errorf("seal %d: verdict %v, want %v", i, verdicts[i], want[i])
+		}
+	}
+}
+
+func TestVerifySealsEpochBound(t *testing.T) {
+	ethash := newTestEthash(t)
+	service := testService(5)
+
+	// The epoch following the head's may be verified, later ones not
+	if _, err := service.VerifySeals(context.Background(), []SealSpec{testSealSpec(ethash, 2*epochLengthDefault-1, 1, true)}); err != nil {
+		t.Errorf("next epoch rejected: %v", err)
+	}
+	far := SealSpec{Header: HeaderSpec{Number: (*hexutil.Big)(testHeader(2 * epochLengthDefault).Number)}}
+	if _, err := service.VerifySeals(context.Background(), []SealSpec{far}); !errors.Is(err, errEpochOutOfRange) {
+		t.Errorf("epoch after next: error %v, want %v", err, errEpochOutOfRange)
+	}
+	huge := SealSpec{Header: HeaderSpec{Number: (*hexutil.Big)(new(big.Int).Lsh(big1, 64))}}
+	if _, err := service.VerifySeals(context.Background(), []SealSpec{huge}); !errors.Is(err, errHeaderNumberRange) {
+		t.Errorf("number beyond 64 bits: error %v, want %v", err, errHeaderNumberRange)
+	}
+	if err := checkEpoch(maxEpoch*epochLengthDefault, math.MaxUint64, nil); !errors.Is(err, errEpochOutOfRange) {
+		t.Errorf("epoch past the size tables: error %v, want %v", err, errEpochOutOfRange)
+	}
+}
+
+func TestVerifyUnclePoW(t *testing.T) {
+	ethash := newTestEthash(t)
+	service := testService(10)
+
+	uncle := func(seal SealSpec) HeaderSpec {
+		header := seal.Header
+		header.Nonce, header.MixDigest = seal.Nonce, seal.MixDigest
+		return header
+	}
+	if valid, err := service.VerifyUnclePoW(context.Background(), uncle(testSealSpec(ethash, 9, 3, true))); err != nil || !valid {
+		t.Errorf("valid uncle: verdict %v, %v, want true", valid, err)
+	}
+	if valid, err := service.VerifyUnclePoW(context.Background(), uncle(testSealSpec(ethash, 9, 3, false))); err != nil || valid {
+		t.Errorf("invalid uncle: verdict %v, %v, want false", valid, err)
+	}
+	if _, err := service.VerifyUnclePoW(context.Background(), uncle(testSealSpec(ethash, 11, 3, true))); !errors.Is(err, errFutureUncle) {
+		t.Errorf("uncle past the head: error %v, want %v", err, errFutureUncle)
+	}
+}
+
+func TestVerifyWithCache(t *testing.T) {
+	ethash := newTestEthash(t)
+	service := new(ClassicService)
+
+	// Full size epoch 0 cache, as an external verifier would supply it
+	words := make([]uint32, cacheSize(0)/4)
+	generateCache(words, 0, epochLengthDefault, seedHash(0, epochLengthDefault))
+	cache := make(hexutil.Bytes, len(words)*4)
+	for i, word := range words {
+		binary.LittleEndian.PutUint32(cache[i*4:], word)
+	}
+	spec := HeaderSpec{Number: (*hexutil.Big)(big.NewInt(100)), Difficulty: (*hexutil.Big)(big.NewInt(1))}
+	header, err := spec.toHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := uint64(42)
+	header.Nonce = types.EncodeNonce(nonce)
+	digest, _ := hashimotoLight(datasetSize(0), words, ethash.SealHash(header).Bytes(), nonce)
+
+	valid, err := service.VerifyWithCache(context.Background(), spec, hexutil.Uint64(nonce), digest, cache)
+	if err != nil || !valid {
+		t.Errorf("valid solution: verified %v, error %v", valid, err)
+	}
+	tampered := append(hexutil.Bytes{}, digest...)
+	tampered[0] ^= 0xff
+	if valid, err := service.VerifyWithCache(context.Background(), spec, hexutil.Uint64(nonce), tampered, cache); err != nil || valid {
+		t.Errorf("tampered mix digest: verified %v, error %v", valid, err)
+	}
+	if _, err := service.VerifyWithCache(context.Background(), spec, hexutil.Uint64(nonce), digest, cache[:len(cache)-64]); err != errInvalidCacheLength {
+		t.Errorf("truncated cache: error %v, want %v", err, errInvalidCacheLength)
+	}
+	if _, err := service.VerifyWithCache(context.Background(), spec, hexutil.Uint64(nonce), digest[:31], cache); err != errInvalidMixDigestLength {
+		t.Errorf("short mix digest: error %v, want %v", err, errInvalidMixDigestLength)
+	}
+}
+
+// sealedTestHeader returns a header with the given number sealed with nonce
+// against the test mode dataset, with its mix digest corrupted unless valid.
+func sealedTestHeader(ethash *Ethash, number int64, nonce uint64, valid bool) *types.Header {
+	seal := testSealSpec(ethash, number, nonce, valid)
+	header := testHeader(number)
+	header.Nonce, header.MixDigest = seal.Nonce, seal.MixDigest
+	return header
+}
+
+func TestVerifyHeaderDataset(t *testing.T) {
+	ethash := newTestEthash(t)
+	service := &DatasetService{&ClassicService{backend: newTestBackend(
+		sealedTestHeader(ethash, 1, 7, true),
+		sealedTestHeader(ethash, 2, 8, false),
+		&types.Header{Number: big.NewInt(3), Difficulty: new(big.Int)},
+	)}}
+
+	// The dataset is generated in the background on first use
+	var (
+		valid bool
+		err   error
+	)
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if valid, err = service.VerifyHeader(context.Background(), 1); !errors.Is(err, errDatasetNotReady) {
+			break
+		}
+	}
+	if err != nil || !valid {
+		t.Fatalf("sealed header: valid %v, error %v", valid, err)
+	}
+	if valid, err := service.VerifyHeader(context.Background(), 2); err != nil || valid {
+		t.Errorf("header with a bad mix digest: valid %v, error %v", valid, err)
+	}
+	if _, err := service.VerifyHeader(context.Background(), 3); err != errInvalidDifficulty {
+		t.Errorf("zero difficulty: error %v, want %v", err, errInvalidDifficulty)
+	}
+	if _, err := service.VerifyHeader(context.Background(), 4); err != errUnknownBlock {
+		t.Errorf("unknown block: error %v, want %v", err, errUnknownBlock)
+	}
+}
@@ -71,6 +71,8 @@ func (ethash *Ethash) mine(block *types.Block, id int, seed uint64, abort chan s
 		number  = header.Number.Uint64()
 		dataset = ethash.dataset(number, false)
 	)
+	defer dataset.unref()
+
 	// Start generating random nonces until we abort or find a good one
 	var (
 		attempts  = int64(0)
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+var (
+	errMissingHeaderNumber = errors.New("header number is required")
+	errGenesisNoParent     = errors.New("genesis block has no parent")
+	errHeaderNumberRange   = errors.New("header number out of range")
+)
+
+// headHeader decodes the current chain head as reported by the backend.
+func (service *ClassicService) headHeader() (*types.Header, error) {
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(service.backend.CurrentHeader(), header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// HeaderSpec is a loosely specified block header as supplied by RPC callers.
+// Unlike types.Header, every field is optional so that callers only need to
+// provide the fields relevant to the check they are requesting.
+type HeaderSpec struct {
+	ParentHash  core.Hash        `json:"parentHash"`
+	UncleHash   core.Hash        `json:"sha3Uncles"`
+	Coinbase    core.Address     `json:"miner"`
+	Root        core.Hash        `json:"stateRoot"`
+	TxHash      core.Hash        `json:"transactionsRoot"`
+	ReceiptHash core.Hash        `json:"receiptsRoot"`
+	Bloom       types.Bloom      `json:"logsBloom"`
+	Difficulty  *hexutil.Big     `json:"difficulty"`
+	Number      *hexutil.Big     `json:"number"`
+	GasLimit    hexutil.Uint64   `json:"gasLimit"`
+	GasUsed     hexutil.Uint64   `json:"gasUsed"`
+	Time        hexutil.Uint64   `json:"timestamp"`
+	Extra       hexutil.Bytes    `json:"extraData"`
+	MixDigest   core.Hash        `json:"mixHash"`
+	Nonce       types.BlockNonce `json:"nonce"`
+	BaseFee     *hexutil.Big     `json:"baseFeePerGas"`
+}
+
+// toHeader converts the spec into a consensus header, failing if the block
+// number is missing or does not fit in 64 bits.
+func (spec *HeaderSpec) toHeader() (*types.Header, error) {
+	if spec.Number == nil {
+		return nil, errMissingHeaderNumber
+	}
+	if !spec.Number.ToInt().IsUint64() {
+		return nil, errHeaderNumberRange
+	}
+	header := &types.Header{
+		ParentHash:  spec.ParentHash,
+		UncleHash:   spec.UncleHash,
+		Coinbase:    spec.Coinbase,
+		Root:        spec.Root,
+		TxHash:      spec.TxHash,
+		ReceiptHash: spec.ReceiptHash,
+		Bloom:       spec.Bloom,
+		Difficulty:  new(big.Int),
+		Number:      new(big.Int).Set(spec.Number.ToInt()),
+		GasLimit:    uint64(spec.GasLimit),
+		GasUsed:     uint64(spec.GasUsed),
+		Time:        uint64(spec.Time),
+		Extra:       spec.Extra,
+		MixDigest:   spec.MixDigest,
+		Nonce:       spec.Nonce,
+	}
+	if spec.Difficulty != nil {
+		header.Difficulty.Set(spec.Difficulty.ToInt())
+	}
+	if spec.BaseFee != nil {
+		header.BaseFee = new(big.Int).Set(spec.BaseFee.ToInt())
+	}
+	return header, nil
+}
+
+// ExpectedHashesPerBlock returns the expected number of hashes needed to find
+// a block at the current head. For ethash this equals the head difficulty.
+func (service *ClassicService) ExpectedHashesPerBlock(ctx context.Context) (*big.Int, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Set(head.Difficulty), nil
+}
+
+// NextBlockDifficulty returns the difficulty a block mined on top of the
+// current head at the given timestamp would be required to have.
+func (service *ClassicService) NextBlockDifficulty(ctx context.Context, assumedTimestamp uint64) (*big.Int, error) {
+	head, err := service.headHeader()
+	if err != nil {
+		return nil, err
+	}
+	if assumedTimestamp <= head.Time {
+		return nil, errOlderBlockTime
+	}
+	return CalcDifficulty(NewPluginConfig(), assumedTimestamp, head), nil
+}
+
+// DifficultyResult compares the difficulty a block is expected to have, given
+// its parent, with the difficulty recorded in its header.
+type DifficultyResult struct {
+	Number   hexutil.Uint64 `json:"number"`
+	Expected *hexutil.Big   `json:"expected"`
+	Recorded *hexutil.Big   `json:"recorded"`
+	Matches  bool           `json:"matches"`
+}
+
+// DifficultyAt recomputes the difficulty of the given block from its parent
+// header and reports whether it matches the recorded one.
+func (service *ClassicService) DifficultyAt(ctx context.Context, number restricted.BlockNumber) (*DifficultyResult, error) {
+	header, err := service.headerByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if header.Number.Sign() == 0 {
+		return nil, errGenesisNoParent
+	}
+	parent, err := service.headerByNumber(ctx, restricted.BlockNumber(header.Number.Int64()-1))
+	if err != nil {
+		return nil, err
+	}
+	if parent.Hash() != header.ParentHash {
+		// The chain reorganised between the two lookups
+		return nil, errParentMismatch
+	}
+	expected := CalcDifficulty(NewPluginConfig(), header.Time, parent)
+	return &DifficultyResult{
+		Number:   hexutil.Uint64(header.Number.Uint64()),
+		Expected: (*hexutil.Big)(expected),
+		Recorded: (*hexutil.Big)(new(big.Int).Set(header.Difficulty)),
+		Matches:  expected.Cmp(header.Difficulty) == 0,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+func TestExpectedHashesPerBlock(t *testing.T) {
+	head := testHeader(15_000_000)
+	head.Difficulty = big.NewInt(3_141_592_653_589)
+	service := &ClassicService{backend: newTestBackend(head)}
+
+	hashes, err := service.ExpectedHashesPerBlock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes.Cmp(head.Difficulty) != 0 {
+		t.Errorf("expected hashes %v, want the head difficulty %v", hashes, head.Difficulty)
+	}
+}
+
+func TestNextBlockDifficulty(t *testing.T) {
+	head := testHeader(15_000_000)
+	head.Time = 1_650_000_000
+	head.Difficulty = big.NewInt(300_000_000_000_000)
+	head.UncleHash = types.EmptyUncleHash
+	service := &ClassicService{backend: newTestBackend(head)}
+
+	difficulty := func(delay uint64) *big.Int {
+		d, err := service.NextBlockDifficulty(context.Background(), head.Time+delay)
+		if err != nil {
+			t.Fatalf("%ds after the head: %v", delay, err)
+		}
+		return d
+	}
+	// Blocks within 9 seconds raise the difficulty, 9 to 17 seconds keep it
+	// and later blocks lower it, by 1/2048 per 9 seconds.
+	if fast := difficulty(5); fast.Cmp(head.Difficulty) <= 0 {
+		t.Errorf("fast block difficulty %v, want above %v", fast, head.Difficulty)
+	}
+	if steady := difficulty(12); steady.Cmp(head.Difficulty) != 0 {
+		t.Errorf("steady block difficulty %v, want %v", steady, head.Difficulty)
+	}
+	if slow, slower := difficulty(30), difficulty(60); slow.Cmp(head.Difficulty) >= 0 || slower.Cmp(slow) >= 0 {
+		t.Errorf("slow block difficulties %v and %v, want decreasing below %v", slow, slower, head.Difficulty)
+	}
+	if _, err := service.NextBlockDifficulty(context.Background(), head.Time); err != errOlderBlockTime {
+		t.Errorf("block at the head's timestamp: error %v, want %v", err, errOlderBlockTime)
+	}
+}
+
+func TestDifficultyAt(t *testing.T) {
+	// Blocks 1 and 2 of the Classic chain, both mined under the Frontier rules
+	parent := &types.Header{Number: big.NewInt(1), Time: 1438269988, Difficulty: big.NewInt(17171480576), UncleHash: types.EmptyUncleHash}
+	header := &types.Header{Number: big.NewInt(2), Time: 1438270017, Difficulty: big.NewInt(17163096064), UncleHash: types.EmptyUncleHash, ParentHash: parent.Hash()}
+	genesis := &types.Header{Number: new(big.Int), Difficulty: big.NewInt(17179869184)}
+	service := &ClassicService{backend: newTestBackend(genesis, parent, header)}
+
+	result, err := service.DifficultyAt(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Matches || result.Expected.ToInt().Cmp(header.Difficulty) != 0 || result.Recorded.ToInt().Cmp(header.Difficulty) != 0 {
+		t.Errorf("block 2: expected %v, recorded %v, matches %v", result.Expected, result.Recorded, result.Matches)
+	}
+
+	// A tampered difficulty is reported as a mismatch
+	header.Difficulty = big.NewInt(17171480576)
+	result, err = service.DifficultyAt(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Matches || result.Expected.ToInt().Cmp(big.NewInt(17163096064)) != 0 {
+		t.Errorf("tampered block 2: expected %v, matches %v", result.Expected, result.Matches)
+	}
+
+	// Block 1 does not name the test genesis as its parent
+	if _, err := service.DifficultyAt(context.Background(), 1); err != errParentMismatch {
+		t.Errorf("block 1: error %v, want %v", err, errParentMismatch)
+	}
+	if _, err := service.DifficultyAt(context.Background(), 0); err != errGenesisNoParent {
+		t.Errorf("genesis: error %v, want %v", err, errGenesisNoParent)
+	}
+}
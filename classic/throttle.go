@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ioThrottle limits the rate at which bytes are produced by sleeping whenever
+// the writers get ahead of the configured rate. A nil throttle is unlimited.
+type ioThrottle struct {
+	mu          sync.Mutex
+	bytesPerSec float64
+	start       time.Time
+	written     uint64
+}
+
+// newIOThrottle creates a throttle for the given rate in MB/s, returning nil
+// if the rate is unlimited.
+func newIOThrottle(mbPerSec int) *ioThrottle {
+	if mbPerSec <= 0 {
+		return nil
+	}
+	return &ioThrottle{bytesPerSec: float64(mbPerSec) * 1024 * 1024, start: time.Now()}
+}
+
+// wait accounts for n written bytes and blocks until the overall rate is
+// back within the limit.
+func (t *ioThrottle) wait(n uint64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.written += n
+	due := t.start.Add(time.Duration(float64(t.written) / t.bytesPerSec * float64(time.Second)))
+	t.mu.Unlock()
+
+	if delay := time.Until(due); delay > 0 {
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestThrottledDatasetGeneration(t *testing.T) {
+	// Every generator thread produces two throttle chunks, limited to a rate
+	// that takes a quarter of a second for the whole dataset.
+	threads := runtime.NumCPU()
+	size := 2 * datasetThrottleChunk * threads
+	rate := size / 1024 / 1024 * 4
+
+	cache := make([]uint32, 1024/4)
+	generateCache(cache, 0, epochLengthDefault, seedHash(0, epochLengthDefault))
+
+	want := make([]uint32, size/4)
+	generateDataset(want, 0, epochLengthDefault, cache)
+
+	have := make([]uint32, size/4)
+	start := time.Now()
+	generateDatasetThrottled(have, 0, epochLengthDefault, cache, newIOThrottle(rate))
+	if elapsed := time.Since(start); elapsed < 240*time.Millisecond {
+		t.Errorf("throttled generation took %v, want about 250ms", elapsed)
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("throttled dataset differs at word %d: have %#x, want %#x", i, have[i], want[i])
+		}
+	}
+	if newIOThrottle(0) != nil {
+		t.Error("zero rate not treated as unlimited")
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
-	"math/big"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math/big"
 
 	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
 )
 
 // Lengths of hashes and addresses in bytes.
@@ -18,17 +21,50 @@ const (
 // Uint64BigMapEncodesHex is a map that encodes and decodes w/ JSON hex format.
 type Uint64BigMapEncodesHex map[uint64]*big.Int
 
+// MarshalJSON encodes the map as a JSON object with 0x-prefixed hex keys and
+// values. Nil values are encoded as zero.
+func (b Uint64BigMapEncodesHex) MarshalJSON() ([]byte, error) {
+	encoded := make(map[string]string, len(b))
+	for k, v := range b {
+		if v == nil {
+			v = new(big.Int)
+		}
+		encoded[hexutil.EncodeUint64(k)] = hexutil.EncodeBig(v)
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes a JSON object with 0x-prefixed hex keys and values.
+func (b *Uint64BigMapEncodesHex) UnmarshalJSON(input []byte) error {
+	var decoded map[hexutil.Uint64]*hexutil.Big
+	if err := json.Unmarshal(input, &decoded); err != nil {
+		return err
+	}
+	m := make(Uint64BigMapEncodesHex, len(decoded))
+	for k, v := range decoded {
+		if v == nil {
+			return fmt.Errorf("missing value for key %d", uint64(k))
+		}
+		m[uint64(k)] = v.ToInt()
+	}
+	*b = m
+	return nil
+}
+
 type ConsensusEngineT int
 
 const (
 	ConsensusEngineT_Unknown = iota
 	ConsensusEngineT_Ethash
+	ConsensusEngineT_Clique
 )
 
 func (c ConsensusEngineT) String() string {
 	switch c {
 	case ConsensusEngineT_Ethash:
 		return "ethash"
+	case ConsensusEngineT_Clique:
+		return "clique"
 	default:
 		return "unknown"
 	}
@@ -38,10 +74,20 @@ func (c ConsensusEngineT) IsEthash() bool {
 	return c == ConsensusEngineT_Ethash
 }
 
+func (c ConsensusEngineT) IsClique() bool {
+	return c == ConsensusEngineT_Clique
+}
+
 func (c ConsensusEngineT) IsUnknown() bool {
 	return c == ConsensusEngineT_Unknown
 }
 
+// CliqueConfig is the consensus engine config of proof-of-authority chains.
+type CliqueConfig struct {
+	Period uint64 `json:"period"` // Number of seconds between blocks to enforce
+	Epoch  uint64 `json:"epoch"`  // Epoch length to reset votes and checkpoint
+}
+
 type BlockSealingT int
 
 // Mode defines the type and amount of PoW verification an ethash engine makes.
@@ -73,6 +119,10 @@ var DisinflationRateQuotient = big.NewInt(4)
 
 var DisinflationRateDivisor  = big.NewInt(5)
 
+// DAOForkBlock is the block at which Ethereum forked to reverse TheDAO. The
+// Classic chain rejected this fork and continued without it.
+var DAOForkBlock = big.NewInt(1920000)
+
 // DAOForkBlockExtra is the block header extra-data field to set for the DAO fork
 // point and a number of consecutive blocks to allow fast/light syncers to correctly
 // pick the side they want  ("dao-hard-fork").
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestUint64BigMapEncodesHex(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789abcdef0123456789abcdef0123456789abcdef", 16)
+	tests := []struct {
+		name    string
+		value   Uint64BigMapEncodesHex
+		encoded string
+	}{
+		{"empty", Uint64BigMapEncodesHex{}, `{}`},
+		{"rewards", Uint64BigMapEncodesHex{0: big.NewInt(5e18), 5000001: big.NewInt(4e18)}, `{"0x0":"0x4563918244f40000","0x4c4b41":"0x3782dace9d900000"}`},
+		{"large", Uint64BigMapEncodesHex{1<<63 + 1: huge}, `{"0x8000000000000001":"0x123456789abcdef0123456789abcdef0123456789abcdef"}`},
+	}
+	for _, tt := range tests {
+		encoded, err := json.Marshal(tt.value)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(encoded) != tt.encoded {
+			t.Errorf("%s: encoded %s, want %s", tt.name, encoded, tt.encoded)
+		}
+		var decoded Uint64BigMapEncodesHex
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if decoded == nil || len(decoded) != len(tt.value) {
+			t.Fatalf("%s: decoded %v, want %v", tt.name, decoded, tt.value)
+		}
+		for k, v := range tt.value {
+			if decoded[k] == nil || decoded[k].Cmp(v) != 0 {
+				t.Errorf("%s: key %d decoded as %v, want %v", tt.name, k, decoded[k], v)
+			}
+		}
+	}
+
+	// Nil values encode as zero, but are rejected when decoding
+	if encoded, _ := json.Marshal(Uint64BigMapEncodesHex{1: nil}); string(encoded) != `{"0x1":"0x0"}` {
+		t.Errorf("nil value encoded as %s", encoded)
+	}
+	for _, input := range []string{`{"0x1":null}`, `{"1":"0x1"}`, `{"0x1":"1"}`} {
+		var decoded Uint64BigMapEncodesHex
+		if err := json.Unmarshal([]byte(input), &decoded); err == nil {
+			t.Errorf("%s: decoded without error", input)
+		}
+	}
+}
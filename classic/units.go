@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// unitDecimals maps the supported denominations to their number of decimals
+// relative to wei.
+var unitDecimals = map[string]int{
+	"wei":   0,
+	"gwei":  9,
+	"ether": 18,
+	"etc":   18,
+}
+
+// formatWei renders a wei amount in the given unit as an exact decimal string.
+func formatWei(wei *big.Int, unit string) (string, error) {
+	decimals, ok := unitDecimals[strings.ToLower(unit)]
+	if !ok {
+		return "", fmt.Errorf("unsupported unit %q, want wei, gwei or ether", unit)
+	}
+	if decimals == 0 {
+		return wei.String(), nil
+	}
+	var (
+		abs     = new(big.Int).Abs(wei)
+		divisor = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+		whole   = new(big.Int)
+		frac    = new(big.Int)
+	)
+	whole.QuoRem(abs, divisor, frac)
+
+	result := whole.String()
+	if frac.Sign() != 0 {
+		digits := fmt.Sprintf("%0*s", decimals, frac.String())
+		result += "." + strings.TrimRight(digits, "0")
+	}
+	if wei.Sign() < 0 {
+		result = "-" + result
+	}
+	return result, nil
+}
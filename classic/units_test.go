@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFormatWei(t *testing.T) {
+	tests := []struct {
+		wei  *big.Int
+		unit string
+		want string
+	}{
+		{etc(4.375), "wei", "4375000000000000000"},
+		{etc(4.375), "gwei", "4375000000"},
+		{etc(4.375), "ether", "4.375"},
+		{etc(3.2), "ETC", "3.2"},
+		{big.NewInt(1), "ether", "0.000000000000000001"},
+		{big.NewInt(1_500), "gwei", "0.0000015"},
+		{big.NewInt(-2_500_000_000), "gwei", "-2.5"},
+		{new(big.Int), "ether", "0"},
+	}
+	for _, tt := range tests {
+		have, err := formatWei(tt.wei, tt.unit)
+		if err != nil {
+			t.Fatalf("%v wei in %s: %v", tt.wei, tt.unit, err)
+		}
+		if have != tt.want {
+			t.Errorf("%v wei in %s: have %q, want %q", tt.wei, tt.unit, have, tt.want)
+		}
+	}
+	if _, err := formatWei(big.NewInt(1), "finney"); err == nil {
+		t.Error("unsupported unit accepted")
+	}
+}
@@ -83,6 +83,18 @@ func VerifyDAOHeaderExtraData(config PluginConfigurator, header *types.Header) e
 	return nil
 }
 
+// ValidateNewContractCode rejects new contract code starting with the 0xEF
+// byte, as required by EIP-3541. Classic adopted EIP-3541 with Mystique, not
+// Magneto, which only brought the Berlin EIPs (2565, 2718, 2929 and 2930).
+// The EVM of the host enforces the rule from the london block of the stored
+// chain config on; this check lets callers apply it ahead of execution.
+func ValidateNewContractCode(config *PluginConfigurator, num *big.Int, code []byte) error {
+	if len(code) > 0 && code[0] == 0xef && config.IsEnabled(config.GetEIP3541Transition, num) {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
 // FromHex returns the bytes represented by the hexadecimal string s.
 // s may be prefixed with "0x".
 func FromHex(s string) []byte {
@@ -294,13 +306,28 @@ func VerifyGaslimit(parentGasLimit, headerGasLimit uint64) error {
 
 func ecip1010Explosion(config PluginConfigurator, next *big.Int, exPeriodRef *big.Int) {
 	// https://github.com/ethereumproject/ECIPs/blob/master/ECIPs/ECIP-1010.md
+	exPeriodRef.Sub(exPeriodRef, calcBombDelay(&config, next))
+}
 
-	if next.Uint64() < *config.GetEthashECIP1010ContinueTransition() {
-		exPeriodRef.SetUint64(*config.GetEthashECIP1010PauseTransition())
-	} else {
-		length := new(big.Int).SetUint64(*config.GetEthashECIP1010ContinueTransition() - *config.GetEthashECIP1010PauseTransition())
-		exPeriodRef.Sub(exPeriodRef, length)
+// calcBombDelay returns the number of blocks subtracted from blockNum before
+// it is divided by ExpDiffPeriod to count the difficulty bomb periods:
+//
+//   - zero before the ECIP-1010 pause,
+//   - blockNum minus the pause block during the pause, freezing the bomb,
+//   - the pause length once the bomb continues,
+//   - blockNum itself from the ECIP-1041 disposal on, defusing the bomb.
+func calcBombDelay(config *PluginConfigurator, blockNum *big.Int) *big.Int {
+	if config.IsEnabled(config.GetEthashECIP1041Transition, blockNum) {
+		return new(big.Int).Set(blockNum)
 	}
+	pause, resume := config.GetEthashECIP1010PauseTransition(), config.GetEthashECIP1010ContinueTransition()
+	if pause == nil || resume == nil || blockNum.Cmp(new(big.Int).SetUint64(*pause)) < 0 {
+		return new(big.Int)
+	}
+	if blockNum.Cmp(new(big.Int).SetUint64(*resume)) < 0 {
+		return new(big.Int).Sub(blockNum, new(big.Int).SetUint64(*pause))
+	}
+	return new(big.Int).SetUint64(*resume - *pause)
 }
 
 // hashimoto aggregates data from the full dataset in order to produce our final
@@ -484,6 +511,27 @@ func calcDatasetSize(epoch uint64) uint64 {
 	return size
 }
 
+// verifyEthashSizes recomputes the cache and dataset sizes for a couple of
+// epochs from the size constants and checks them against the canonical
+// ethash values, catching accidental edits to the constants.
+func verifyEthashSizes() error {
+	if size := calcCacheSize(0); size != 16776896 {
+		return fmt.Errorf("ethash cache size for epoch 0: have %d, want %d", size, 16776896)
+	}
+	if size := calcDatasetSize(0); size != 1073739904 {
+		return fmt.Errorf("ethash dataset size for epoch 0: have %d, want %d", size, 1073739904)
+	}
+	for _, epoch := range []uint64{0, 1, maxEpoch / 2, maxEpoch - 1} {
+		if have, want := calcCacheSize(epoch), cacheSizes[epoch]; have != want {
+			return fmt.Errorf("ethash cache size for epoch %d: have %d, want %d", epoch, have, want)
+		}
+		if have, want := calcDatasetSize(epoch), datasetSizes[epoch]; have != want {
+			return fmt.Errorf("ethash dataset size for epoch %d: have %d, want %d", epoch, have, want)
+		}
+	}
+	return nil
+}
+
 // cacheSize returns the size of the ethash verification cache that belongs to a certain
 // block number.
 func cacheSize(epoch uint64) uint64 {
@@ -517,6 +565,11 @@ func seedHash(epoch uint64, epochLength uint64) []byte {
 // algorithm from Strict Memory Hard Hashing Functions (2014). The output is a
 // set of 524288 64-byte values.
 // This method places the result into dest in machine byte order.
+//
+// The seed is supplied by the caller: the regular code paths pass
+// seedHash(epoch, epochLength), while an explicit seed can be passed to
+// reproduce external test vectors. epoch and epochLength are only used for
+// logging.
 func generateCache(dest []uint32, epoch uint64, epochLength uint64, seed []byte) {
 	// Print some debug logs to allow analysis on low end devices
 	// logger := log.New("epoch", epoch)
@@ -546,6 +599,10 @@ func generateCache(dest []uint32, epoch uint64, epochLength uint64, seed []byte)
 	// Start a monitoring goroutine to report progress on low end devices
 	var progress atomic.Uint32
 
+	defer jobs.start("cache", epoch, func() float64 {
+		return float64(progress.Load()) * 100 / float64(rows) / (cacheRounds + 1)
+	})()
+
 	done := make(chan struct{})
 	defer close(done)
 
@@ -672,6 +729,17 @@ func memoryMapAndGenerate(path string, size uint64, lock bool, generator func(bu
 // generateDataset generates the entire ethash dataset for mining.
 // This method places the result into dest in machine byte order.
 func generateDataset(dest []uint32, epoch uint64, epochLength uint64, cache []uint32) {
+	generateDatasetThrottled(dest, epoch, epochLength, cache, nil)
+}
+
+// datasetThrottleChunk is the number of bytes each generator thread produces
+// between consulting the I/O throttle.
+const datasetThrottleChunk = 1024 * 1024
+
+// generateDatasetThrottled is generateDataset with the rate at which dest is
+// filled limited by throttle, so that generating a memory mapped dataset
+// yields disk bandwidth to the chain database. A nil throttle is unlimited.
+func generateDatasetThrottled(dest []uint32, epoch uint64, epochLength uint64, cache []uint32, throttle *ioThrottle) {
 	// Print some debug logs to allow analysis on low end devices
 	// logger := log.New("epoch", epoch)
 
@@ -705,6 +773,19 @@ func generateDataset(dest []uint32, epoch uint64, epochLength uint64, cache []ui
 	pend.Add(threads)
 
 	var progress atomic.Uint64
+	dagGen.begin(epoch, size/hashBytes, &progress)
+	defer dagGen.end(&progress)
+
+	defer jobs.start("dataset", epoch, func() float64 {
+		return float64(progress.Load()) * 100 / float64(size/hashBytes)
+	})()
+
+	publishDAGEvent(DAGGenerationEvent{Stage: "started", Epoch: epoch})
+	defer func() {
+		publishDAGEvent(DAGGenerationEvent{Stage: "completed", Epoch: epoch, Percentage: 100, Elapsed: time.Since(start).Seconds()})
+	}()
+	milestone := size / hashBytes / 10
+
 	for i := 0; i < threads; i++ {
 		go func(id int) {
 			defer pend.Done()
@@ -721,6 +802,7 @@ func generateDataset(dest []uint32, epoch uint64, epochLength uint64, cache []ui
 			}
 			// Calculate the dataset segment
 			percent := size / hashBytes / 100
+			var pending uint64
 			for index := first; index < limit; index++ {
 				item := generateDatasetItem(cache, uint32(index), keccak512)
 				if swapped {
@@ -728,9 +810,18 @@ func generateDataset(dest []uint32, epoch uint64, epochLength uint64, cache []ui
 				}
 				copy(dataset[index*hashBytes:], item)
 
-				if status := progress.Add(1); status%percent == 0 {
+				if pending += hashBytes; pending >= datasetThrottleChunk {
+					throttle.wait(pending)
+					pending = 0
+				}
+
+				status := progress.Add(1)
+				if status%percent == 0 {
 					log.Info("Generating DAG in progress", "epochLength", epochLength, "percentage", (status*100)/(size/hashBytes), "elapsed", time.Since(start))
 				}
+				if milestone > 0 && status%milestone == 0 && status/milestone < 10 {
+					publishDAGEvent(DAGGenerationEvent{Stage: "progress", Epoch: epoch, Percentage: status / milestone * 10, Elapsed: time.Since(start).Seconds()})
+				}
 			}
 		}(i)
 	}
@@ -799,6 +890,84 @@ func (d *dataset) finalizer() {
 	}
 }
 
+// ref marks the cache as in use, preventing release from unmapping it until
+// the matching unref.
+func (c *cache) ref() {
+	c.refs.Lock()
+	defer c.refs.Unlock()
+	c.users++
+}
+
+// unref ends a use of the cache, unmapping it if it was released meanwhile.
+func (c *cache) unref() {
+	c.refs.Lock()
+	defer c.refs.Unlock()
+	c.users--
+	if c.users == 0 && c.evicted {
+		c.finalizer()
+		c.cache = nil
+	}
+}
+
+// release closes the memory map and file of a cache dropped by its lru, as soon
+// as the last user is done with it.
+func (c *cache) release() {
+	c.refs.Lock()
+	defer c.refs.Unlock()
+	c.evicted = true
+	if c.users == 0 {
+		c.finalizer()
+		c.cache = nil
+	}
+}
+
+// restore undoes the release of a cache that is handed out again while still
+// being generated.
+func (c *cache) restore() {
+	c.refs.Lock()
+	defer c.refs.Unlock()
+	c.evicted = false
+}
+
+// ref marks the dataset as in use, preventing release from unmapping it until
+// the matching unref.
+func (d *dataset) ref() {
+	d.refs.Lock()
+	defer d.refs.Unlock()
+	d.users++
+}
+
+// unref ends a use of the dataset, unmapping it if it was released meanwhile.
+func (d *dataset) unref() {
+	d.refs.Lock()
+	defer d.refs.Unlock()
+	d.users--
+	if d.users == 0 && d.evicted {
+		d.finalizer()
+		d.dataset = nil
+	}
+}
+
+// release closes the memory map and file of a dataset dropped by its lru, as
+// soon as the last user is done with it.
+func (d *dataset) release() {
+	d.refs.Lock()
+	defer d.refs.Unlock()
+	d.evicted = true
+	if d.users == 0 {
+		d.finalizer()
+		d.dataset = nil
+	}
+}
+
+// restore undoes the release of a dataset that is handed out again while still
+// being generated.
+func (d *dataset) restore() {
+	d.refs.Lock()
+	defer d.refs.Unlock()
+	d.evicted = false
+}
+
 // ensureSize expands the file to the given size. This is to prevent runtime
 // errors later on, if the underlying file expands beyond the disk capacity,
 // even though it ostensibly is already expanded, but due to being sparse
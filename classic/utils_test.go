@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+func TestVerifyEthashSizes(t *testing.T) {
+	if err := verifyEthashSizes(); err != nil {
+		t.Fatal(err)
+	}
+	if size := cacheSize(1); size != 16907456 {
+		t.Errorf("cache size for epoch 1: have %d, want %d", size, 16907456)
+	}
+	if size := datasetSize(1); size != 1082130304 {
+		t.Errorf("dataset size for epoch 1: have %d, want %d", size, 1082130304)
+	}
+
+	// An edited size table is caught
+	saved := datasetSizes[maxEpoch/2]
+	datasetSizes[maxEpoch/2] += mixBytes
+	defer func() { datasetSizes[maxEpoch/2] = saved }()
+
+	if err := verifyEthashSizes(); err == nil {
+		t.Error("edited dataset size table passed the self-check")
+	}
+}
+
+func TestGenerateCacheSeed(t *testing.T) {
+	// 1024 byte cache from the all zero seed, as published with the go-ethereum
+	// ethash test vectors.
+	want := hexutil.MustDecode("0x" +
+		"7ce2991c951f7bf4c4c1bb119887ee07871eb5339d7b97b8588e85c742de90e5bafd5bbe6ce93a134fb6be9ad3e30db99d9528a2ea7846833f52e9ca119b6b54" +
+		"8979480c46e19972bd0738779c932c1b43e665a2fd3122fc3ddb2691f353ceb0ed3e38b8f51fd55b6940290743563c9f8fa8822e611924657501a12aafab8a8d" +
+		"88fb5fbae3a99d14792406672e783a06940a42799b1c38bc28715db6d37cb11f9f6b24e386dc52dd8c286bd8c36fa813dffe4448a9f56ebcbeea866b42f68d22" +
+		"6c32aae4d695a23cab28fd74af53b0c2efcc180ceaaccc0b2e280103d097a03c1d1b0f0f26ce5f32a90238f9bc49f645db001ef9cd3d13d44743f841fad11a37" +
+		"fa290c62c16042f703578921f30b9951465aae2af4a5dad43a7341d7b4a62750954965a47a1c3af638dc3495c4d62a9bab843168c9fc0114e79cffd1b2827b01" +
+		"75d30ba054658f214e946cf24c43b40d3383fbb0493408e5c5392434ca21bbcf43200dfb876c713d201813934fa485f48767c5915745cf0986b1dc0f33e57748" +
+		"bf483ee2aff4248dfe461ec0504a13628401020fc22638584a8f2f5206a13b2f233898c78359b21c8226024d0a7a93df5eb6c282bdbf005a4aab497e096f2847" +
+		"76c71cee57932a8fb89f6d6b8743b60a4ea374899a94a2e0f218d5c55818cefb1790c8529a76dba31ebb0f4592d709b49587d2317970d39c086f18dd244291d9" +
+		"eedb16705e53e3350591bd4ff4566a3595ac0f0ce24b5e112a3d033bc51b6fea0a92296dea7f5e20bf6ee6bc347d868fda193c395b9bb147e55e5a9f67cfe741" +
+		"7eea7d699b155bd13804204df7ea91fa9249e4474dddf35188f77019c67d201e4c10d7079c5ad492a71afff9a23ca7e900ba7d1bdeaf3270514d8eb35eab8a0a" +
+		"718bb7273aeb37768fa589ed8ab01fbf4027f4ebdbbae128d21e485f061c20183a9bc2e31edbda0727442e9d58eb0fe198440fe199e02e77c0f7b99973f1f74c" +
+		"c9089a51ab96c94a84d66e6aa48b2d0a4543adb5a789039a2aa7b335ca85c91026c7d3c894da53ae364188c3fd92f78e01d080399884a47385aa792e38150cda" +
+		"a8620b2ebeca41fbc773bb837b5e724d6eb2de570d99858df0d7d97067fb8103b21757873b735097b35d3bea8fd1c359a9e8a63c1540c76c9784cf8d975e995c" +
+		"778401b94a2e66e6993ad67ad3ecdc2acb17779f1ea8606827ec92b11c728f8c3b6d3f04a3e6ed05ff81dd76d5dc5695a50377bc135aaf1671cf68b750315493" +
+		"6c64510164d53312bf3c41740c7a237b05faf4a191bd8a95dafa068dbcf370255c725900ce5c934f36feadcfe55b687c440574c1f06f39d207a8553d39156a24" +
+		"845f64fd8324bb85312979dead74f764c9677aab89801ad4f927f1c00f12e28f22422bb44200d1969d9ab377dd6b099dc6dbc3222e9321b2c1e84f8e2f07731c")
+
+	dest := make([]uint32, len(want)/4)
+	generateCache(dest, 0, epochLengthDefault, make([]byte, 32))
+	have := make([]byte, len(want))
+	for i, word := range dest {
+		binary.LittleEndian.PutUint32(have[i*4:], word)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("cache mismatch:\nhave %x\nwant %x", have, want)
+	}
+
+	// A supplied seed replaces the epoch derived one
+	derived := make([]uint32, len(want)/4)
+	generateCache(derived, 1, epochLengthDefault, seedHash(1, epochLengthDefault))
+	for i := range dest {
+		if dest[i] != derived[i] {
+			return
+		}
+	}
+	t.Error("epoch 1 seed generated the same cache as the zero seed")
+}
+
+func TestCalcDifficultyBomb(t *testing.T) {
+	// A parent difficulty of 1e14 is adjusted in steps of 1e14 / 2048 by the
+	// Homestead rules, before Atlantis brought EIP-100.
+	const step = 48_828_125_000
+
+	tests := []struct {
+		parent uint64
+		delay  uint64
+		want   uint64
+	}{
+		// Before the ECIP-1010 pause the bomb grows every 100,000 blocks
+		{2_999_998, 15, 1e14 + 1<<27},
+		// Paused at period 30 from block 3,000,000
+		{2_999_999, 15, 1e14 + 1<<28},
+		{4_500_000, 5, 1e14 + step + 1<<28},
+		// Continued from block 5,000,000 with a delay of 2,000,000 blocks
+		{4_999_999, 25, 1e14 - step + 1<<28},
+		{5_000_000, 15, 1e14 + 1<<28},
+		{5_899_998, 15, 1e14 + 1<<36},
+		// Defused by ECIP-1041 from block 5,900,000
+		{5_899_999, 15, 1e14},
+		{6_000_000, 5, 1e14 + step},
+	}
+	for _, tt := range tests {
+		parent := &types.Header{
+			Number:     new(big.Int).SetUint64(tt.parent),
+			Time:       1_500_000_000,
+			Difficulty: big.NewInt(1e14),
+			UncleHash:  types.EmptyUncleHash,
+		}
+		if difficulty := CalcDifficulty(NewPluginConfig(), parent.Time+tt.delay, parent); difficulty.Uint64() != tt.want {
+			t.Errorf("block %d, %ds after its parent: difficulty %v, want %d", tt.parent+1, tt.delay, difficulty, tt.want)
+		}
+	}
+}
+
+func TestVerifyDAOHeaderExtraData(t *testing.T) {
+	var (
+		fork  = DAOForkBlock.Int64()
+		clean = []byte("clean")
+	)
+	daoConfig := *NewPluginConfig()
+	daoConfig.DAOForkBlock = DAOForkBlock
+
+	tests := []struct {
+		config PluginConfigurator
+		number int64
+		extra  []byte
+		err    error
+	}{
+		// Classic never forked, so neither header is rejected
+		{*NewPluginConfig(), fork, DAOForkBlockExtra, nil},
+		{*NewPluginConfig(), fork, clean, nil},
+		{*NewPluginConfig(), fork + 9, clean, nil},
+		// A config with the fork requires the marker within the range only
+		{daoConfig, fork - 1, clean, nil},
+		{daoConfig, fork, DAOForkBlockExtra, nil},
+		{daoConfig, fork, clean, ErrBadProDAOExtra},
+		{daoConfig, fork + 9, clean, ErrBadProDAOExtra},
+		{daoConfig, fork + 10, clean, nil},
+	}
+	for i, tt := range tests {
+		header := &types.Header{Number: big.NewInt(tt.number), Extra: tt.extra}
+		if err := VerifyDAOHeaderExtraData(tt.config, header); err != tt.err {
+			t.Errorf("test %d: block %d with extra %q: error %v, want %v", i, tt.number, tt.extra, err, tt.err)
+		}
+	}
+}
+
+func TestCalcBombDelay(t *testing.T) {
+	tests := []struct {
+		number int64
+		delay  int64
+	}{
+		// Before the pause
+		{0, 0},
+		{2_999_999, 0},
+		// Paused, the delay grows with the block number
+		{3_000_000, 0},
+		{4_000_000, 1_000_000},
+		{4_999_999, 1_999_999},
+		// Continued, delayed by the length of the pause
+		{5_000_000, 2_000_000},
+		{5_899_999, 2_000_000},
+		// Defused by ECIP-1041
+		{5_900_000, 5_900_000},
+		{20_000_000, 20_000_000},
+	}
+	for _, tt := range tests {
+		if delay := calcBombDelay(NewPluginConfig(), big.NewInt(tt.number)); delay.Int64() != tt.delay {
+			t.Errorf("block %d: bomb delay %v, want %d", tt.number, delay, tt.delay)
+		}
+	}
+}
+
+func TestValidateNewContractCode(t *testing.T) {
+	const (
+		magneto  = 13_189_133
+		mystique = 14_525_000
+	)
+	var (
+		efCode     = []byte{0xef, 0x00, 0x01}
+		normalCode = []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+	)
+	tests := []struct {
+		number int64
+		code   []byte
+		err    error
+	}{
+		// Magneto brought the Berlin EIPs only, 0xEF code is still accepted
+		{magneto - 1, efCode, nil},
+		{magneto, efCode, nil},
+		{magneto + 1, efCode, nil},
+		{magneto, normalCode, nil},
+		// EIP-3541 is active from Mystique on
+		{mystique - 1, efCode, nil},
+		{mystique, efCode, ErrInvalidCode},
+		{mystique, normalCode, nil},
+		{mystique, nil, nil},
+	}
+	for _, tt := range tests {
+		if err := ValidateNewContractCode(NewPluginConfig(), big.NewInt(tt.number), tt.code); err != tt.err {
+			t.Errorf("block %d, code %x: error %v, want %v", tt.number, tt.code, err, tt.err)
+		}
+	}
+	if IsMagneto(big.NewInt(magneto-1)) || !IsMagneto(big.NewInt(magneto)) {
+		t.Errorf("Magneto activation not at block %d", magneto)
+	}
+}
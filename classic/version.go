@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+const plugethUtilsModule = "github.com/openrelayxyz/plugeth-utils"
+
+// The range of plugeth-utils versions, provided by the host, this plugin is
+// known to work with. The upper bound is exclusive.
+var (
+	minPlugethUtilsVersion = "v1.5.0"
+	maxPlugethUtilsVersion = "v1.6.0"
+)
+
+// hostPlugethUtilsVersion returns the plugeth-utils version linked into the
+// host binary, if it can be determined.
+func hostPlugethUtilsVersion() (string, bool) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", false
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != plugethUtilsModule {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version, true
+		}
+		return dep.Version, true
+	}
+	return "", false
+}
+
+// checkPlugethUtilsVersion returns an error if the given version is outside
+// the supported range.
+func checkPlugethUtilsVersion(version string) error {
+	v, err := parseVersion(version)
+	if err != nil {
+		return err
+	}
+	min, _ := parseVersion(minPlugethUtilsVersion)
+	max, _ := parseVersion(maxPlugethUtilsVersion)
+	if compareVersions(v, min) < 0 || compareVersions(v, max) >= 0 {
+		return fmt.Errorf("plugeth-utils %s is not supported by the Classic plugin, which requires >= %s and < %s", version, minPlugethUtilsVersion, maxPlugethUtilsVersion)
+	}
+	return nil
+}
+
+// parseVersion parses the major, minor and patch components of a semantic
+// version such as v1.5.0, ignoring any pre-release or build suffix.
+func parseVersion(version string) ([3]int, error) {
+	var parts [3]int
+	trimmed := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(trimmed, "-+"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+	fields := strings.Split(trimmed, ".")
+	if len(fields) != 3 {
+		return parts, fmt.Errorf("invalid version %q", version)
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return parts, fmt.Errorf("invalid version %q", version)
+		}
+		parts[i] = n
+	}
+	return parts, nil
+}
+
+// compareVersions returns -1, 0 or 1 if a is lower, equal or higher than b.
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPlugethUtilsVersion(t *testing.T) {
+	for _, version := range []string{"v1.5.0", "v1.5.3", "v1.5.9-rc1", "1.5.0"} {
+		if err := checkPlugethUtilsVersion(version); err != nil {
+			t.Errorf("%s: %v", version, err)
+		}
+	}
+	for _, version := range []string{"v1.4.9", "v1.6.0", "v2.0.0"} {
+		err := checkPlugethUtilsVersion(version)
+		if err == nil || !strings.Contains(err.Error(), "not supported by the Classic plugin") {
+			t.Errorf("%s: error %v, want an unsupported version error", version, err)
+		}
+	}
+	for _, version := range []string{"", "v1.5", "latest"} {
+		if err := checkPlugethUtilsVersion(version); err == nil {
+			t.Errorf("%q accepted", version)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math/big"
+	"path/filepath"
+	"strings"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+)
+
+// Kotti is a Proof-of-Authority testnet. Blocks are sealed by the host's
+// Clique engine, so unlike the classic and mordor plugins this plugin provides
+// no consensus engine and no ethash block rewards are ever credited.
+
+var (
+	// KottiBootnodes is empty: Kotti peers are found through DNS discovery.
+	KottiBootnodes = []string{}
+
+	dnsPrefixETC string = "enrtree://AJE62Q4DUX4QMMXEHCSSCSC65TDHZYSMONSD64P3WULVLSF6MRQ3K@"
+
+	KottiDNSNetwork1 = dnsPrefixETC + "all.kotti.blockd.info"
+
+	forkBlockIds = []uint64{716617, 1705549, 2200013, 4368634, 5578000}
+
+	forkTimeIds = []uint64{}
+
+	kottiGenesisHash = core.HexToHash("0x14c2283285a88fe5fce9bf5c573ab03d6616695d717b12a127188bcacfc743c4")
+)
+
+var (
+	pl  core.PluginLoader
+	log core.Logger
+)
+
+var (
+	mainnetFlag = "mainnet"
+	goerliFlag  = "goerli"
+	sepoliaFlag = "sepolia"
+	holeskyFlag = "holesky"
+
+	networkPanicMsg = "This node is optimized to run the Kotti testnet only, check datadir/plugins/ for a kotti.so binary and remove it if this is not the desired behavior"
+)
+
+func Initialize(ctx core.Context, loader core.PluginLoader, logger core.Logger) {
+	pl = loader
+	log = logger
+
+	switch {
+	case ctx.Bool(mainnetFlag):
+		panic(networkPanicMsg)
+	case ctx.Bool(goerliFlag):
+		panic(networkPanicMsg)
+	case ctx.Bool(sepoliaFlag):
+		panic(networkPanicMsg)
+	case ctx.Bool(holeskyFlag):
+		panic(networkPanicMsg)
+	}
+
+	log.Info("Loaded Kotti testnet plugin")
+}
+
+func Is1559(*big.Int) bool {
+	return false
+}
+
+func Is160(num *big.Int) bool {
+	r := num.Cmp(big.NewInt(0))
+	return r >= 0
+}
+
+// IsShanghai reports false, Spiral was never scheduled on Kotti.
+func IsShanghai(num *big.Int) bool {
+	return false
+}
+
+// InitializeNode writes the Kotti chain config, using Clique instead of
+// ethash, to the database.
+func InitializeNode(node core.Node, backend restricted.Backend) {
+	db := backend.ChainDb()
+
+	cfg := []byte(`{
+		"chainId": 6,
+		"networkId": 6,
+		"homesteadBlock": 0,
+		"daoForkBlock": null,
+		"daoForkSupport": false,
+		"eip150Block": 0,
+		"eip155Block": 0,
+		"eip158Block": 0,
+		"byzantiumBlock": 716617,
+		"constantinopleBlock": 1705549,
+		"petersburgBlock": 1705549,
+		"istanbulBlock": 2200013,
+		"berlinBlock": 4368634,
+		"londonBlock": 5578000,
+		"clique": {
+			"period": 15,
+			"epoch": 30000
+		}
+	}`)
+
+	if err := db.Put(append([]byte("ethereum-config-"), kottiGenesisHash.Bytes()...), cfg); err != nil {
+		log.Error("Error loading Kotti config", "err", err)
+	}
+}
+
+func ForkIDs([]uint64, []uint64) ([]uint64, []uint64) {
+	return forkBlockIds, forkTimeIds
+}
+
+func SetDefaultDataDir(path string) string {
+	return filepath.Join(path, "kotti")
+}
+
+func OpCodeSelect() []int {
+	codes := []int{0x48}
+	return codes
+}
+
+func SetNetworkId() *uint64 {
+	kottiNetworkId := uint64(6)
+	return &kottiNetworkId
+}
+
+func SetBootstrapNodes() []string {
+	return KottiBootnodes
+}
+
+func SetETHDiscoveryURLs(lightSync bool) []string {
+	url := KottiDNSNetwork1
+	if lightSync {
+		url = strings.Replace(url, "@all.", "@les.", 1)
+	}
+	return []string{url}
+}
+
+// SetSnapDiscoveryURLs returns the snap DNS discovery tree, independently of
+// SetETHDiscoveryURLs.
+func SetSnapDiscoveryURLs() []string {
+	return []string{strings.Replace(KottiDNSNetwork1, "@all.", "@snap.", 1)}
+}
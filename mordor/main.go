@@ -21,11 +21,11 @@ var (
 
 	dnsPrefixETC string = "enrtree://AJE62Q4DUX4QMMXEHCSSCSC65TDHZYSMONSD64P3WULVLSF6MRQ3K@"
 
-	snapDiscoveryURLs []string
-
 	forkBlockIds = []uint64 {301243, 999983, 2520000, 3985893, 5520000, 9957000}                        
 
 	forkTimeIds = []uint64{}
+
+	mordorGenesisHash = core.HexToHash("0xa68ebde7932eccb177d38d55dcc6461a019dd795a681e59b5a3e4f3a7259a3f1")
 )
 
 type ClassicService struct {
@@ -47,20 +47,14 @@ var (
 	sepoliaFlag = "sepolia"
 	holeskyFlag = "holesky"
 
-	networkPanicMsg = "This node is optimized to run the Ethereum Classic Network only, check datadir/plugins/ for a classic.so binary and remove it if this is not the desired behavior"
+	networkPanicMsg = "This node is optimized to run the Mordor testnet only, check datadir/plugins/ for a mordor.so binary and remove it if this is not the desired behavior"
 )
 
 func Initialize(ctx core.Context, loader core.PluginLoader, logger core.Logger) { 
 	pl = loader
 	events = pl.GetFeed()
 	log = logger
-	v := ctx.String(httpApiFlagName)
-	if v != "" {
-		ctx.Set(httpApiFlagName, v+",plugeth")
-	} else {
-		ctx.Set(httpApiFlagName, "eth,net,web3,plugeth")
-		
-	}
+	ctx.Set(httpApiFlagName, withPlugethAPI(ctx.String(httpApiFlagName)))
 
 	switch {
 		case ctx.Bool(mainnetFlag):
@@ -77,6 +71,20 @@ func Initialize(ctx core.Context, loader core.PluginLoader, logger core.Logger)
 	log.Info("Loaded Mordor testnet plugin")
 }
 
+// withPlugethAPI appends the plugeth namespace to a comma separated http.api
+// value unless it is already listed, defaulting to eth,net,web3,plugeth.
+func withPlugethAPI(v string) string {
+	if v == "" {
+		return "eth,net,web3,plugeth"
+	}
+	for _, api := range strings.Split(v, ",") {
+		if strings.TrimSpace(api) == "plugeth" {
+			return v
+		}
+	}
+	return v + ",plugeth"
+}
+
 func Is1559(*big.Int) bool {
 	return false
 }
@@ -97,25 +105,23 @@ func InitializeNode(node core.Node, backend restricted.Backend) {
 	cfg := []byte(`{
 		"chainId": 63,
 		"networkId": 7,
-		"homesteadBlock": 1150000,
+		"homesteadBlock": 0,
 		"daoForkBlock": null,
 		"daoForkSupport": false,
-		"eip150Block": 2500000,
-		"eip155Block": 3000000,
-		"eip158Block": 8772000,
-		"byzantiumBlock": 8772000,
-		"constantinopleBlock": 9573000,
-		"petersburgBlock": 9573000,
-		"istanbulBlock": 10500839,
-		"berlinBlock": 13189133,
-		"londonBlock": 14525000,
+		"eip150Block": 0,
+		"eip155Block": 0,
+		"eip158Block": 0,
+		"byzantiumBlock": 0,
+		"constantinopleBlock": 301243,
+		"petersburgBlock": 301243,
+		"istanbulBlock": 999983,
+		"berlinBlock": 3985893,
+		"londonBlock": 5520000,
 		"ethash": {}
 	}`)
 
-	hash := core.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3")
-
-	if err := db.Put(append([]byte("ethereum-config-"), hash.Bytes()...), cfg); err != nil {
-		log.Error("Error loading Classic config", "err", err)
+	if err := db.Put(append([]byte("ethereum-config-"), mordorGenesisHash.Bytes()...), cfg); err != nil {
+		log.Error("Error loading Mordor config", "err", err)
 	}
 }
 
@@ -151,8 +157,8 @@ func OpCodeSelect() []int {
 
 func SetNetworkId() *uint64 {
 	var networkId *uint64
-	classicNetworkId := uint64(1)
-	networkId = &classicNetworkId
+	mordorNetworkId := uint64(7)
+	networkId = &mordorNetworkId
 	return networkId 
 }
 
@@ -162,21 +168,19 @@ func SetBootstrapNodes() []string {
 }
 
 func SetETHDiscoveryURLs(lightSync bool) []string {
-
 	url := ClassicDNSNetwork1
-	if lightSync == true {
-		url = strings.ReplaceAll(url, "all", "les")
+	if lightSync {
+		url = strings.Replace(url, "@all.", "@les.", 1)
 	}
-	result := []string{url}
-	snapDiscoveryURLs = result
-
-	return result
+	return []string{url}
 }
 
+// SetSnapDiscoveryURLs returns the snap DNS discovery tree, independently of
+// SetETHDiscoveryURLs.
 func SetSnapDiscoveryURLs() []string {
-	return snapDiscoveryURLs
+	return []string{strings.Replace(ClassicDNSNetwork1, "@all.", "@snap.", 1)}
 }
 
 func (service *ClassicService) Test(ctx context.Context) string {
-	return "total classic"
+	return "total mordor"
 }
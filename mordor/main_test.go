@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+// testChainDb records the values put into it. Database methods it does not
+// override panic, the embedded interface being nil.
+type testChainDb struct {
+	restricted.Database
+	values map[string][]byte
+}
+
+func (db *testChainDb) Put(key, value []byte) error {
+	db.values[string(key)] = value
+	return nil
+}
+
+// testBackend serves a testChainDb. Backend methods it does not override
+// panic, the embedded interface being nil.
+type testBackend struct {
+	restricted.Backend
+	db *testChainDb
+}
+
+func (b *testBackend) ChainDb() restricted.Database { return b.db }
+
+func TestMordorGenesisHash(t *testing.T) {
+	genesis := &types.Header{
+		Root:        core.HexToHash("0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"),
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		UncleHash:   types.EmptyUncleHash,
+		Difficulty:  big.NewInt(0x20000),
+		Number:      big.NewInt(0),
+		GasLimit:    0x2fefd8,
+		Time:        0x5d9676db,
+		Extra:       hexutil.MustDecode("0x70686f656e697820636869636b656e206162737572642062616e616e61"),
+	}
+	if hash := genesis.Hash(); hash != mordorGenesisHash {
+		t.Errorf("genesis hash %x, want %x", hash, mordorGenesisHash)
+	}
+}
+
+func TestInitializeNode(t *testing.T) {
+	db := &testChainDb{values: make(map[string][]byte)}
+	InitializeNode(nil, &testBackend{db: db})
+
+	data, ok := db.values[string(append([]byte("ethereum-config-"), mordorGenesisHash.Bytes()...))]
+	if !ok || len(db.values) != 1 {
+		t.Fatalf("config not stored under the Mordor genesis key, stored %d values", len(db.values))
+	}
+	var config struct {
+		ChainID   uint64    `json:"chainId"`
+		NetworkID uint64    `json:"networkId"`
+		Ethash    *struct{} `json:"ethash"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("stored config invalid: %v", err)
+	}
+	if config.ChainID != 63 || config.NetworkID != 7 || config.Ethash == nil {
+		t.Errorf("stored chain id %d, network id %d, ethash %v, want 63, 7 and ethash", config.ChainID, config.NetworkID, config.Ethash != nil)
+	}
+	if id := SetNetworkId(); id == nil || *id != 7 {
+		t.Errorf("network id %v, want 7", id)
+	}
+}
+
+func TestSnapDiscoveryURLs(t *testing.T) {
+	want := dnsPrefixETC + "snap.mordor.blockd.info"
+	if urls := SetSnapDiscoveryURLs(); len(urls) != 1 || urls[0] != want {
+		t.Errorf("snap discovery URLs %v, want [%s]", urls, want)
+	}
+	if urls := SetETHDiscoveryURLs(true); len(urls) != 1 || urls[0] != dnsPrefixETC+"les.mordor.blockd.info" {
+		t.Errorf("light sync discovery URLs %v", urls)
+	}
+	if urls := SetSnapDiscoveryURLs(); len(urls) != 1 || urls[0] != want {
+		t.Errorf("snap discovery URLs after light sync %v, want [%s]", urls, want)
+	}
+}
+
+func TestWithPlugethAPI(t *testing.T) {
+	tests := []struct {
+		api  string
+		want string
+	}{
+		{"", "eth,net,web3,plugeth"},
+		{"eth,debug", "eth,debug,plugeth"},
+		{"eth,plugeth,debug", "eth,plugeth,debug"},
+		{"plugeth", "plugeth"},
+	}
+	for _, tt := range tests {
+		api := withPlugethAPI(tt.api)
+		if api != tt.want {
+			t.Errorf("http.api %q: got %q, want %q", tt.api, api, tt.want)
+		}
+		if again := withPlugethAPI(api); again != api {
+			t.Errorf("http.api %q: reapplied %q, want %q", tt.api, again, api)
+		}
+	}
+}